@@ -0,0 +1,19 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// EnvInt lee una variable de entorno entera; si no existe o no es válida devuelve def.
+func EnvInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
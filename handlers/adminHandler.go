@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminHandler struct {
+	service    services.AdminService
+	categories services.CategoryService
+}
+
+func NewAdminHandler(s services.AdminService, cs services.CategoryService) *AdminHandler {
+	return &AdminHandler{service: s, categories: cs}
+}
+
+// adminError traduce los errores de la API de administración a códigos HTTP.
+func adminError(c *fiber.Ctx, err error) error {
+	switch {
+	case err.Error() == "usuario no encontrado" || err.Error() == "categoría no encontrada":
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case err.Error() == "la categoría ya existe":
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err.Error() == "no puedes deshabilitar tu propia cuenta" ||
+		err.Error() == "no puedes quitarte el rol de administrador" ||
+		err.Error() == "el nombre de la categoría es obligatorio" ||
+		err.Error() == "tipo inválido (ingreso | gasto)" ||
+		strings.HasPrefix(err.Error(), "rol inválido"):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// ListUsers lista o busca usuarios (?q= en email, username o nombre; ?page=&limit=).
+func (h *AdminHandler) ListUsers(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "page inválido"})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit inválido"})
+	}
+
+	result, err := h.service.ListUsers(c.Context(), c.Query("q"), page, limit)
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(result)
+}
+
+func (h *AdminHandler) GetUser(c *fiber.Ctx) error {
+	user, err := h.service.GetUser(c.Context(), c.Params("id"))
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(user)
+}
+
+func (h *AdminHandler) DisableUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("userID").(string)
+	if err := h.service.SetUserDisabled(requestContext(c), adminID, c.Params("id"), true); err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Cuenta deshabilitada"})
+}
+
+func (h *AdminHandler) EnableUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("userID").(string)
+	if err := h.service.SetUserDisabled(requestContext(c), adminID, c.Params("id"), false); err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Cuenta habilitada"})
+}
+
+func (h *AdminHandler) ForcePasswordReset(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("userID").(string)
+	if err := h.service.ForcePasswordReset(requestContext(c), adminID, c.Params("id")); err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "El usuario deberá restablecer su contraseña"})
+}
+
+func (h *AdminHandler) SetUserRoles(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("userID").(string)
+	var req services.SetRolesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+	if err := h.service.SetUserRoles(requestContext(c), adminID, c.Params("id"), req.Roles); err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Roles actualizados"})
+}
+
+func (h *AdminHandler) GetStats(c *fiber.Ctx) error {
+	stats, err := h.service.GetStats(c.Context())
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(stats)
+}
+
+// ListDuplicateReports lista los reportes repetidos por usuario y periodo que impiden crear el índice único.
+func (h *AdminHandler) ListDuplicateReports(c *fiber.Ctx) error {
+	duplicates, err := h.service.ListDuplicateReports(c.Context())
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(fiber.Map{"duplicates": duplicates})
+}
+
+func (h *AdminHandler) CreateCategory(c *fiber.Ctx) error {
+	var req models.Category
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+	category, err := h.categories.CreateCategory(c.Context(), req)
+	if err != nil {
+		return adminError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+func (h *AdminHandler) DeleteCategory(c *fiber.Ctx) error {
+	if err := h.categories.DeleteCategory(c.Context(), c.Params("id")); err != nil {
+		return adminError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Categoría eliminada"})
+}
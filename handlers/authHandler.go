@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/JimcostDev/finances-api/middleware"
+	"github.com/JimcostDev/finances-api/ratelimit"
 	"github.com/JimcostDev/finances-api/services"
 	"github.com/gofiber/fiber/v2"
 )
@@ -12,10 +16,14 @@ import (
 type AuthHandler struct {
 	service services.AuthService
 	users   services.UserService
+	// loginLimiter cuenta credenciales/códigos fallidos por cuenta y por IP
+	loginLimiter *ratelimit.Limiter
+	// mfaLimiter cuenta los códigos 2FA fallidos por cuenta; una contraseña correcta no lo reinicia
+	mfaLimiter *ratelimit.Limiter
 }
 
-func NewAuthHandler(s services.AuthService, us services.UserService) *AuthHandler {
-	return &AuthHandler{service: s, users: us}
+func NewAuthHandler(s services.AuthService, us services.UserService, loginLimiter, mfaLimiter *ratelimit.Limiter) *AuthHandler {
+	return &AuthHandler{service: s, users: us, loginLimiter: loginLimiter, mfaLimiter: mfaLimiter}
 }
 
 // cookieSecure: HTTPS directo, proxy (Koyeb, etc.) o COOKIE_SECURE=true.
@@ -38,6 +46,64 @@ func cookieSameSite(secure bool) string {
 	return "Lax"
 }
 
+// setAuthCookies guarda access y refresh token en cookies HttpOnly.
+func setAuthCookies(c *fiber.Ctx, tokens *services.AuthTokens) {
+	secure := cookieSecure(c)
+	c.Cookie(&fiber.Cookie{
+		Name:     middleware.AuthCookieName,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		MaxAge:   int(time.Until(tokens.AccessExpiresAt).Seconds()),
+		HTTPOnly: true,
+		Secure:   secure,
+		SameSite: cookieSameSite(secure),
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     middleware.RefreshCookieName,
+		Value:    tokens.RefreshToken,
+		Path:     middleware.RefreshCookiePath,
+		MaxAge:   int(time.Until(tokens.RefreshExpiresAt).Seconds()),
+		HTTPOnly: true,
+		Secure:   secure,
+		SameSite: cookieSameSite(secure),
+	})
+}
+
+// authResponse responde al login/refresh con el token anti-CSRF de la sesión (en cuerpo y cabecera),
+// que el frontend debe reenviar en X-CSRF-Token en las peticiones que modifican datos.
+func authResponse(c *fiber.Ctx, message string, tokens *services.AuthTokens) error {
+	c.Set(middleware.CSRFHeaderName, tokens.CSRFToken)
+	return c.JSON(fiber.Map{"message": message, "csrf_token": tokens.CSRFToken})
+}
+
+// clearAuthCookies borra ambas cookies (mismo Path con el que se crearon).
+func clearAuthCookies(c *fiber.Ctx) {
+	secure := cookieSecure(c)
+	for name, path := range map[string]string{
+		middleware.AuthCookieName:    "/",
+		middleware.RefreshCookieName: middleware.RefreshCookiePath,
+	} {
+		c.Cookie(&fiber.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     path,
+			MaxAge:   -1,
+			HTTPOnly: true,
+			Secure:   secure,
+			SameSite: cookieSameSite(secure),
+		})
+	}
+}
+
+// accountBlocked: credenciales correctas pero la cuenta no puede iniciar sesión (403).
+func accountBlocked(err error) bool {
+	switch err.Error() {
+	case "email no verificado", "cuenta deshabilitada", "debes restablecer tu contraseña", "cuenta pendiente de eliminación":
+		return true
+	}
+	return false
+}
+
 // Register maneja la solicitud de registro
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req services.RegisterRequest
@@ -47,7 +113,10 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 
 	user, err := h.service.RegisterUser(c.Context(), req)
 	if err != nil {
-		if err.Error() == "las contraseñas no coinciden" || err.Error() == "el email o el username ya existen" {
+		if handled, rerr := passwordPolicyError(c, err); handled {
+			return rerr
+		}
+		if err.Error() == "las contraseñas no coinciden" || err.Error() == "el email o el username ya existen" || err.Error() == "email inválido" {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -63,29 +132,129 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
 	}
 
-	token, err := h.service.LoginUser(c.Context(), req)
+	// Intentos por IP y por cuenta: con cualquiera de los dos bloqueado se responde 429
+	ipKey := "login:ip:" + middleware.ClientIP(c)
+	accountKey := "login:account:" + strings.ToLower(strings.TrimSpace(req.Email))
+	wait, err := h.loginLimiter.Check(c.Context(), ipKey, accountKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if wait > 0 {
+		return middleware.TooManyRequests(c, wait)
+	}
+
+	result, err := h.service.LoginUser(requestContext(c), req)
 	if err != nil {
 		if err.Error() == "credenciales inválidas" {
+			if wait, herr := h.loginLimiter.Hit(c.Context(), ipKey, accountKey); herr == nil && wait > 0 {
+				return middleware.TooManyRequests(c, wait)
+			}
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 		}
+		if accountBlocked(err) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	secure := cookieSecure(c)
-	c.Cookie(&fiber.Cookie{
-		Name:     middleware.AuthCookieName,
-		Value:    token,
-		Path:     "/",
-		MaxAge:   30 * 24 * 60 * 60,
-		HTTPOnly: true,
-		Secure:   secure,
-		SameSite: cookieSameSite(secure),
-	})
+	// Contraseña correcta: se reinicia el contador de contraseñas de la cuenta (el de la IP caduca solo;
+	// el de códigos 2FA fallidos, no: solo lo reinicia un segundo factor correcto)
+	_ = h.loginLimiter.Reset(c.Context(), accountKey)
+
+	// Con 2FA no hay cookie todavía: el cliente debe enviar el código a /login/2fa
+	if result.MFAToken != "" {
+		return c.JSON(fiber.Map{
+			"message":      "Introduce el código de verificación",
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
+	}
+
+	setAuthCookies(c, result.Tokens)
+	return authResponse(c, "Sesión iniciada", result.Tokens)
+}
+
+// LoginMFA completa el login con el token "mfa pending" y un código TOTP o de recuperación.
+func (h *AuthHandler) LoginMFA(c *fiber.Ctx) error {
+	var req services.MFALoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	// Los códigos fallidos se cuentan por IP, por token "mfa pending" y por cuenta. El contador de la
+	// cuenta sobrevive a los nuevos tokens (cada contraseña correcta emite uno) y la bloquea tras MFA_MAX_FAILURES
+	ipKey := "login:ip:" + middleware.ClientIP(c)
+	mfaSum := sha256.Sum256([]byte(req.MFAToken))
+	mfaKey := "login:mfa:" + hex.EncodeToString(mfaSum[:])
+	var accountKeys []string
+	if userID := h.service.MFATokenUserID(req.MFAToken); userID != "" {
+		accountKeys = append(accountKeys, "login:mfa-account:"+userID)
+	}
+	wait, err := h.loginLimiter.Check(c.Context(), ipKey, mfaKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	accountWait, err := h.mfaLimiter.Check(c.Context(), accountKeys...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if accountWait > wait {
+		wait = accountWait
+	}
+	if wait > 0 {
+		return middleware.TooManyRequests(c, wait)
+	}
+
+	tokens, err := h.service.CompleteMFALogin(requestContext(c), req)
+	if err != nil {
+		if err.Error() == "token de verificación inválido o expirado" || err.Error() == "código de verificación inválido" {
+			wait, herr := h.loginLimiter.Hit(c.Context(), ipKey, mfaKey)
+			if herr == nil {
+				if accountWait, aerr := h.mfaLimiter.Hit(c.Context(), accountKeys...); aerr == nil && accountWait > wait {
+					wait = accountWait
+				}
+			}
+			if herr == nil && wait > 0 {
+				return middleware.TooManyRequests(c, wait)
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		if accountBlocked(err) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	_ = h.mfaLimiter.Reset(c.Context(), accountKeys...)
+	setAuthCookies(c, tokens)
+	return authResponse(c, "Sesión iniciada", tokens)
+}
+
+// Refresh rota el refresh token (cookie) y emite un nuevo access token. Exige X-CSRF-Token.
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	refreshToken := c.Cookies(middleware.RefreshCookieName)
+	if refreshToken == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token no proporcionado"})
+	}
+
+	tokens, err := h.service.RefreshSession(c.Context(), refreshToken, c.Get(middleware.CSRFHeaderName))
+	if err != nil {
+		if err.Error() == "sesión inválida o expirada" {
+			clearAuthCookies(c)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err.Error() == "token CSRF inválido o ausente" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	return c.JSON(fiber.Map{"message": "Sesión iniciada"})
+	setAuthCookies(c, tokens)
+	return authResponse(c, "Sesión renovada", tokens)
 }
 
 // Me devuelve el perfil del usuario autenticado (cookie o Bearer).
+// Con sesión, la cabecera X-CSRF-Token lleva el token anti-CSRF (p. ej. tras recargar la página).
 func (h *AuthHandler) Me(c *fiber.Ctx) error {
 	userIDStr, ok := c.Locals("userID").(string)
 	if !ok || userIDStr == "" {
@@ -95,20 +264,301 @@ func (h *AuthHandler) Me(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
 	}
+	if csrfToken, _ := c.Locals("csrfToken").(string); csrfToken != "" {
+		c.Set(middleware.CSRFHeaderName, csrfToken)
+	}
 	return c.JSON(user)
 }
 
-// Logout borra la cookie de sesión (no requiere JWT válido).
+// Logout revoca la sesión en el servidor y borra las cookies (no requiere JWT válido).
+// Con cookies exige X-CSRF-Token, como el resto de peticiones que modifican estado.
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
-	secure := cookieSecure(c)
-	c.Cookie(&fiber.Cookie{
-		Name:     middleware.AuthCookieName,
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HTTPOnly: true,
-		Secure:   secure,
-		SameSite: cookieSameSite(secure),
+	err := h.service.Logout(requestContext(c), services.LogoutRequest{
+		RefreshToken:    c.Cookies(middleware.RefreshCookieName),
+		AccessToken:     middleware.TokenFromRequest(c),
+		AccessViaCookie: c.Cookies(middleware.AuthCookieName) != "",
+		CSRFToken:       c.Get(middleware.CSRFHeaderName),
 	})
+	if err != nil && err.Error() == "token CSRF inválido o ausente" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	clearAuthCookies(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Sesión cerrada"})
+}
+
+// ListSessions lista los dispositivos con sesión activa; "current" marca la sesión de esta petición.
+func (h *AuthHandler) ListSessions(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+	currentSessionID, _ := c.Locals("sessionID").(string)
+
+	sessions, err := h.service.ListSessions(c.Context(), userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	resp := make([]fiber.Map, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, fiber.Map{
+			"id":           session.ID.Hex(),
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"current":      session.ID.Hex() == currentSessionID,
+		})
+	}
+	return c.JSON(resp)
+}
+
+// RevokeSession cierra una sesión concreta del usuario.
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+	sessionID := c.Params("id")
+
+	if err := h.service.RevokeSession(requestContext(c), userIDStr, sessionID); err != nil {
+		if err.Error() == "sesión no encontrada" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Si se cerró la sesión actual, también borramos las cookies
+	if current, _ := c.Locals("sessionID").(string); current == sessionID {
+		clearAuthCookies(c)
+	}
 	return c.JSON(fiber.Map{"message": "Sesión cerrada"})
 }
+
+// RevokeOtherSessions cierra la sesión en todos los demás dispositivos.
+func (h *AuthHandler) RevokeOtherSessions(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+	currentSessionID, _ := c.Locals("sessionID").(string)
+
+	revoked, err := h.service.RevokeOtherSessions(requestContext(c), userIDStr, currentSessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Sesiones cerradas en los demás dispositivos", "revoked": revoked})
+}
+
+// ForgotPassword envía el enlace de recuperación; responde igual exista o no el email.
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req services.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+	if req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "El email es obligatorio"})
+	}
+
+	if err := h.service.ForgotPassword(c.Context(), req); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Si el email está registrado, recibirás un enlace para restablecer la contraseña"})
+}
+
+// ResetPassword establece una nueva contraseña con el token recibido por correo.
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req services.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	if err := h.service.ResetPassword(requestContext(c), req); err != nil {
+		if handled, rerr := passwordPolicyError(c, err); handled {
+			return rerr
+		}
+		switch err.Error() {
+		case "token inválido o expirado", "las contraseñas no coinciden", "la contraseña es obligatoria":
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Contraseña restablecida. Inicia sesión de nuevo"})
+}
+
+// VerifyEmail confirma el email con el token recibido por correo.
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req services.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	if err := h.service.VerifyEmail(requestContext(c), req); err != nil {
+		switch err.Error() {
+		case "token inválido o expirado":
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case "el email ya está en uso":
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Email verificado"})
+}
+
+// ResendVerification reenvía el enlace de verificación; responde igual exista o no el email.
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	var req services.ResendVerificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+	if req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "El email es obligatorio"})
+	}
+
+	if err := h.service.ResendVerification(c.Context(), req); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Si el email está pendiente de verificación, recibirás un nuevo enlace"})
+}
+
+// twoFactorError traduce los errores de 2FA a códigos HTTP.
+func twoFactorError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "código de verificación inválido", "credenciales inválidas":
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case "la verificación en dos pasos ya está activada", "la verificación en dos pasos no está activada", "no hay una configuración de dos pasos pendiente":
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case "usuario no encontrado":
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// SetupTwoFactor devuelve el secreto y la URI otpauth:// para el QR.
+func (h *AuthHandler) SetupTwoFactor(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	setup, err := h.service.SetupTwoFactor(c.Context(), userIDStr)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.JSON(setup)
+}
+
+// EnableTwoFactor confirma el primer código y devuelve los códigos de recuperación (solo se muestran una vez).
+func (h *AuthHandler) EnableTwoFactor(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+	var req services.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	codes, err := h.service.EnableTwoFactor(requestContext(c), userIDStr, req)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Verificación en dos pasos activada", "recovery_codes": codes})
+}
+
+// DisableTwoFactor desactiva 2FA con contraseña + código.
+func (h *AuthHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+	var req services.DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	if err := h.service.DisableTwoFactor(requestContext(c), userIDStr, req); err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Verificación en dos pasos desactivada"})
+}
+
+// RegenerateRecoveryCodes emite códigos de recuperación nuevos.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+	var req services.TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(c.Context(), userIDStr, req)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// ListPersonalTokens lista los tokens personales del usuario (sin el valor).
+func (h *AuthHandler) ListPersonalTokens(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	tokens, err := h.service.ListPersonalTokens(c.Context(), userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(tokens)
+}
+
+// CreatePersonalToken crea un token; el valor ("token") solo se muestra en esta respuesta.
+func (h *AuthHandler) CreatePersonalToken(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+	var req services.CreatePersonalTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	token, err := h.service.CreatePersonalToken(requestContext(c), userIDStr, req)
+	if err != nil {
+		switch err.Error() {
+		case "el nombre del token es obligatorio", "scope inválido (read | read_write)", "la fecha de expiración debe ser futura":
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(token)
+}
+
+// DeletePersonalToken revoca un token personal.
+func (h *AuthHandler) DeletePersonalToken(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	if err := h.service.DeletePersonalToken(requestContext(c), userIDStr, c.Params("id")); err != nil {
+		if err.Error() == "token no encontrado" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Token revocado"})
+}
+
+// JWKS publica las claves públicas de firma (/.well-known/jwks.json).
+func (h *AuthHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.service.JWKS())
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/JimcostDev/finances-api/models"
 	"github.com/JimcostDev/finances-api/services"
@@ -26,6 +27,9 @@ func (h *ReportHandler) CreateReport(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	report, err := h.service.CreateReport(c.Context(), userID, req)
 	if err != nil {
+		if handled, resp := periodError(c, err); handled {
+			return resp
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -39,15 +43,40 @@ func (h *ReportHandler) CreateReport(c *fiber.Ctx) error {
 		"diezmos":             report.Diezmos,
 		"ofrendas":            report.Ofrendas,
 		"iglesia":             report.Iglesia,
+		"deducciones":         report.Deducciones,
+		"total_deducciones":   report.TotalDeducciones,
 		"ingresos_netos":      report.IngresosNetos,
 		"total_gastos":        report.TotalGastos,
 		"liquidacion":         report.Liquidacion,
+		"saldo_inicial":       report.SaldoInicial,
+		"saldo_final":         report.SaldoFinal,
 		"created_at":          report.CreatedAt,
 		"updated_at":          report.UpdatedAt,
+		"cerrado":             report.Cerrado,
+		"cerrado_en":          report.CerradoEn,
+		"cierres":             report.Cierres,
+		"version":             report.Version,
 	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
 	return c.Status(fiber.StatusCreated).JSON(response)
 }
 
+// isDateError indica errores de validación de fechas de items o rangos.
+func isDateError(err error) bool {
+	return strings.HasPrefix(err.Error(), "fecha") || err.Error() == "zona horaria inválida"
+}
+
+// periodError responde 400 si el mes, el año o la fecha de un item no son válidos y 409 si el periodo ya tiene reporte.
+func periodError(c *fiber.Ctx, err error) (bool, error) {
+	switch {
+	case strings.HasPrefix(err.Error(), "mes inválido"), err.Error() == "año inválido", isDateError(err):
+		return true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case err.Error() == "ya existe un reporte para ese mes y año":
+		return true, c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return false, nil
+}
+
 // UpdateReport actualiza un reporte
 func (h *ReportHandler) UpdateReport(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -56,33 +85,66 @@ func (h *ReportHandler) UpdateReport(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
 	}
 
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+
 	userID := c.Locals("userID").(string)
-	result, err := h.service.UpdateReport(c.Context(), id, userID, req)
+	result, err := h.service.UpdateReport(c.Context(), id, userID, version, req)
 	if err != nil {
 		if err.Error() == "not found" {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Reporte no encontrado"})
 		}
+		if err.Error() == "el reporte cambió desde que lo leíste" {
+			return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err.Error() == "el reporte se modificó al mismo tiempo, inténtalo de nuevo" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		if handled, resp := closedReportError(c, err); handled {
+			return resp
+		}
+		if handled, resp := periodError(c, err); handled {
+			return resp
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if v, ok := result["version"].(int64); ok {
+		c.Set(fiber.HeaderETag, reportETag(v))
+	}
 	return c.JSON(fiber.Map{
 		"message": "Reporte actualizado exitosamente",
 		"data":    result,
 	})
 }
 
-// GetReports obtiene todos
+// GetReports obtiene todos; con ?from=&to= (AAAA-MM-DD) solo los meses de ese rango, cada uno
+// con "rango" (sus items de esas fechas y sus totales)
 func (h *ReportHandler) GetReports(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
+	rng, err := services.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	reports, err := h.service.GetReports(c.Context(), userID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// Liquidación acumulada mes a mes (con arrastre activo coincide con saldo_final)
+	running := services.RunningBalances(reports)
+
 	// Conversión para el frontend (ObjectID a Hex string)
 	var reportsResp []fiber.Map
-	for _, report := range reports {
-		reportsResp = append(reportsResp, fiber.Map{
+	for i := range reports {
+		report := &reports[i]
+		if !rng.IncludesReport(report) {
+			continue
+		}
+		resp := fiber.Map{
 			"id":                  report.ID.Hex(),
 			"user_id":             report.UserID.Hex(),
 			"month":               report.Month,
@@ -94,27 +156,46 @@ func (h *ReportHandler) GetReports(c *fiber.Ctx) error {
 			"diezmos":             report.Diezmos,
 			"ofrendas":            report.Ofrendas,
 			"iglesia":             report.Iglesia,
+			"deducciones":         report.Deducciones,
+			"total_deducciones":   report.TotalDeducciones,
 			"ingresos_netos":      report.IngresosNetos,
 			"total_gastos":        report.TotalGastos,
 			"liquidacion":         report.Liquidacion,
+			"saldo_inicial":       report.SaldoInicial,
+			"saldo_final":         report.SaldoFinal,
+			"saldo_acumulado":     running[report.ID],
 			"created_at":          report.CreatedAt,
 			"updated_at":          report.UpdatedAt,
-		})
+			"cerrado":             report.Cerrado,
+			"cerrado_en":          report.CerradoEn,
+			"cierres":             report.Cierres,
+			"version":             report.Version,
+		}
+		if !rng.IsZero() {
+			resp["rango"] = services.FilterReportItems(report, rng)
+		}
+		reportsResp = append(reportsResp, resp)
 	}
 	return c.JSON(reportsResp)
 }
 
-// GetReportByID un reporte
+// GetReportByID un reporte; con ?from=&to= (AAAA-MM-DD) añade "rango" con los items de esas fechas
 func (h *ReportHandler) GetReportByID(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	id := c.Params("id")
 
+	rng, err := services.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	report, err := h.service.GetReportByID(c.Context(), id, userID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Reporte no encontrado"})
 	}
 
-	return c.JSON(fiber.Map{
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
+	response := fiber.Map{
 		"id":                  report.ID.Hex(),
 		"user_id":             report.UserID.Hex(),
 		"month":               report.Month,
@@ -126,15 +207,33 @@ func (h *ReportHandler) GetReportByID(c *fiber.Ctx) error {
 		"diezmos":             report.Diezmos,
 		"ofrendas":            report.Ofrendas,
 		"iglesia":             report.Iglesia,
+		"deducciones":         report.Deducciones,
+		"total_deducciones":   report.TotalDeducciones,
 		"ingresos_netos":      report.IngresosNetos,
 		"total_gastos":        report.TotalGastos,
 		"liquidacion":         report.Liquidacion,
+		"saldo_inicial":       report.SaldoInicial,
+		"saldo_final":         report.SaldoFinal,
 		"created_at":          report.CreatedAt,
 		"updated_at":          report.UpdatedAt,
-	})
+		"cerrado":             report.Cerrado,
+		"cerrado_en":          report.CerradoEn,
+		"cierres":             report.Cierres,
+		"version":             report.Version,
+	}
+	if !rng.IsZero() {
+		response["rango"] = services.FilterReportItems(report, rng)
+	}
+	return c.JSON(response)
 }
 
-// GetReportsByMonth filtro
+// reportWithRange es un reporte con los items de ?from=&to= (solo si se pidió un rango).
+type reportWithRange struct {
+	models.Report
+	Rango *services.ItemsInRange `json:"rango,omitempty"`
+}
+
+// GetReportsByMonth filtro; con ?from=&to= (AAAA-MM-DD) cada reporte añade "rango"
 func (h *ReportHandler) GetReportsByMonth(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	month := c.Query("month")
@@ -142,15 +241,30 @@ func (h *ReportHandler) GetReportsByMonth(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "El año debe ser válido"})
 	}
+	rng, err := services.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	reports, err := h.service.GetReportsByMonth(c.Context(), userID, month, year)
 	if err != nil {
+		if handled, resp := periodError(c, err); handled {
+			return resp
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	if len(reports) == 0 {
 		return c.JSON(fiber.Map{"message": "No se encontraron reportes"})
 	}
-	return c.JSON(reports)
+	if rng.IsZero() {
+		return c.JSON(reports)
+	}
+	withRange := make([]reportWithRange, len(reports))
+	for i := range reports {
+		items := services.FilterReportItems(&reports[i], rng)
+		withRange[i] = reportWithRange{Report: reports[i], Rango: &items}
+	}
+	return c.JSON(withRange)
 }
 
 // DeleteReport elimina
@@ -163,11 +277,60 @@ func (h *ReportHandler) DeleteReport(c *fiber.Ctx) error {
 		if err.Error() == "not found" {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Reporte no encontrado"})
 		}
+		if handled, resp := closedReportError(c, err); handled {
+			return resp
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(fiber.Map{"message": "Reporte eliminado exitosamente"})
 }
 
+// reportETag es el ETag de una versión del reporte.
+func reportETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion lee la versión de If-Match ("3", W/"3" o * para cualquiera).
+// Si falta responde 428 y si no corresponde a ninguna versión, 412.
+func ifMatchVersion(c *fiber.Ctx) (int64, bool, error) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return 0, false, c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{"error": "Falta la cabecera If-Match con el ETag del reporte"})
+	}
+	if header == "*" {
+		return services.AnyVersion, true, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil || version < 0 {
+		return 0, false, c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": "el reporte cambió desde que lo leíste"})
+	}
+	return version, true, nil
+}
+
+// itemMutationError responde 412 si el cliente editó una versión antigua, 409 si el reporte
+// cambió en todos los reintentos y 500 en otro caso.
+func itemMutationError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "el reporte cambió desde que lo leíste":
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": err.Error()})
+	case "el reporte se modificó al mismo tiempo, inténtalo de nuevo":
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case "income not found":
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Ingreso no encontrado"})
+	case "expense not found":
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Gasto no encontrado"})
+	case "no hay campos para actualizar":
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if handled, resp := closedReportError(c, err); handled {
+		return resp
+	}
+	if isDateError(err) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
 // AddIncome
 func (h *ReportHandler) AddIncome(c *fiber.Ctx) error {
 	reportID := c.Params("id")
@@ -177,10 +340,15 @@ func (h *ReportHandler) AddIncome(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("userID").(string)
-	report, err := h.service.AddIncome(c.Context(), reportID, userID, newIncome)
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+	report, err := h.service.AddIncome(c.Context(), reportID, userID, version, newIncome)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return itemMutationError(c, err)
 	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
 	return c.JSON(fiber.Map{"message": "Ingreso agregado exitosamente", "report": report})
 }
 
@@ -193,10 +361,15 @@ func (h *ReportHandler) AddExpense(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("userID").(string)
-	report, err := h.service.AddExpense(c.Context(), reportID, userID, newExpense)
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+	report, err := h.service.AddExpense(c.Context(), reportID, userID, version, newExpense)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return itemMutationError(c, err)
 	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
 	return c.JSON(fiber.Map{"message": "Gasto agregado exitosamente", "report": report})
 }
 
@@ -206,10 +379,15 @@ func (h *ReportHandler) RemoveIncome(c *fiber.Ctx) error {
 	incomeID := c.Params("income_id")
 	userID := c.Locals("userID").(string)
 
-	report, err := h.service.RemoveIncome(c.Context(), reportID, userID, incomeID)
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+	report, err := h.service.RemoveIncome(c.Context(), reportID, userID, version, incomeID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return itemMutationError(c, err)
 	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
 	return c.JSON(fiber.Map{"message": "Ingreso eliminado exitosamente", "report": report})
 }
 
@@ -219,13 +397,62 @@ func (h *ReportHandler) RemoveExpense(c *fiber.Ctx) error {
 	expenseID := c.Params("expense_id")
 	userID := c.Locals("userID").(string)
 
-	report, err := h.service.RemoveExpense(c.Context(), reportID, userID, expenseID)
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+	report, err := h.service.RemoveExpense(c.Context(), reportID, userID, version, expenseID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return itemMutationError(c, err)
 	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
 	return c.JSON(fiber.Map{"message": "Gasto eliminado exitosamente", "report": report})
 }
 
+// UpdateIncome edita parcialmente un ingreso (concepto, monto, categoria_id, fecha, fecha_hora, zona_horaria)
+func (h *ReportHandler) UpdateIncome(c *fiber.Ctx) error {
+	reportID := c.Params("id")
+	incomeID := c.Params("income_id")
+	var patch services.ItemPatch
+	if err := c.BodyParser(&patch); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	userID := c.Locals("userID").(string)
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+	report, err := h.service.UpdateIncome(c.Context(), reportID, userID, version, incomeID, patch)
+	if err != nil {
+		return itemMutationError(c, err)
+	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
+	return c.JSON(fiber.Map{"message": "Ingreso actualizado exitosamente", "report": report})
+}
+
+// UpdateExpense edita parcialmente un gasto (concepto, monto, categoria_id, fecha, fecha_hora, zona_horaria)
+func (h *ReportHandler) UpdateExpense(c *fiber.Ctx) error {
+	reportID := c.Params("id")
+	expenseID := c.Params("expense_id")
+	var patch services.ItemPatch
+	if err := c.BodyParser(&patch); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	userID := c.Locals("userID").(string)
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+	report, err := h.service.UpdateExpense(c.Context(), reportID, userID, version, expenseID, patch)
+	if err != nil {
+		return itemMutationError(c, err)
+	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
+	return c.JSON(fiber.Map{"message": "Gasto actualizado exitosamente", "report": report})
+}
+
 // GetAnnualReport
 func (h *ReportHandler) GetAnnualReport(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
@@ -262,3 +489,88 @@ func (h *ReportHandler) GetGeneralBalance(c *fiber.Ctx) error {
 
 	return c.JSON(result)
 }
+
+// GetCashFlow flujo de caja diario entre ?from= y ?to= (AAAA-MM-DD, máximo 366 días)
+func (h *ReportHandler) GetCashFlow(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	rng, err := services.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	flow, err := h.service.GetCashFlow(c.Context(), userID, rng)
+	if err != nil {
+		if isDateError(err) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(flow)
+}
+
+// closedReportError responde 423 si el reporte está cerrado.
+func closedReportError(c *fiber.Ctx, err error) (bool, error) {
+	if err.Error() == "el reporte está cerrado; reábrelo para modificarlo" {
+		return true, c.Status(fiber.StatusLocked).JSON(fiber.Map{"error": err.Error()})
+	}
+	return false, nil
+}
+
+// closureRequest es el cuerpo de close/reopen: {"reason": "..."}.
+type closureRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CloseReport cierra el periodo (motivo opcional); exige If-Match como el resto de escrituras
+func (h *ReportHandler) CloseReport(c *fiber.Ctx) error {
+	return h.setClosed(c, true)
+}
+
+// ReopenReport reabre un periodo cerrado; el motivo es obligatorio y queda en "cierres"
+func (h *ReportHandler) ReopenReport(c *fiber.Ctx) error {
+	return h.setClosed(c, false)
+}
+
+func (h *ReportHandler) setClosed(c *fiber.Ctx, closed bool) error {
+	var req closureRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+		}
+	}
+
+	userID := c.Locals("userID").(string)
+	version, ok, resp := ifMatchVersion(c)
+	if !ok {
+		return resp
+	}
+
+	var report *models.Report
+	var err error
+	if closed {
+		report, err = h.service.CloseReport(c.Context(), c.Params("id"), userID, version, req.Reason)
+	} else {
+		report, err = h.service.ReopenReport(c.Context(), c.Params("id"), userID, version, req.Reason)
+	}
+	if err != nil {
+		switch {
+		case err.Error() == "not found" || err.Error() == "invalid report ID":
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Reporte no encontrado"})
+		case err.Error() == "el reporte cambió desde que lo leíste":
+			return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": err.Error()})
+		case err.Error() == "el reporte ya está cerrado" || err.Error() == "el reporte no está cerrado" ||
+			err.Error() == "el reporte se modificó al mismo tiempo, inténtalo de nuevo":
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "motivo"):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	message := "Reporte cerrado exitosamente"
+	if !closed {
+		message = "Reporte reabierto exitosamente"
+	}
+	c.Set(fiber.HeaderETag, reportETag(report.Version))
+	return c.JSON(fiber.Map{"message": message, "report": report})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/JimcostDev/finances-api/middleware"
+	"github.com/JimcostDev/finances-api/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// requestContext es c.Context() con la IP y el User-Agent del cliente para los servicios.
+func requestContext(c *fiber.Ctx) context.Context {
+	return services.WithRequestMeta(c.Context(), services.RequestMeta{
+		IP:        middleware.ClientIP(c),
+		UserAgent: utils.CopyString(c.Get(fiber.HeaderUserAgent)),
+	})
+}
+
+// passwordPolicyError responde 400 con los incumplimientos de la política de contraseñas, si err lo es.
+func passwordPolicyError(c *fiber.Ctx, err error) (bool, error) {
+	policyErr, ok := services.AsPasswordPolicyError(err)
+	if !ok {
+		return false, nil
+	}
+	return true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":      policyErr.Error(),
+		"violations": policyErr.Violations,
+	})
+}
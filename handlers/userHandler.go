@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"io"
+	"strconv"
+	"strings"
+
 	"github.com/JimcostDev/finances-api/services"
 	"github.com/gofiber/fiber/v2"
 )
 
 type UserHandler struct {
 	service services.UserService
+	exports services.ExportService
+	imports services.ImportService
 }
 
-func NewUserHandler(s services.UserService) *UserHandler {
-	return &UserHandler{service: s}
+func NewUserHandler(s services.UserService, exports services.ExportService, imports services.ImportService) *UserHandler {
+	return &UserHandler{service: s, exports: exports, imports: imports}
 }
 
 func (h *UserHandler) GetUserProfile(c *fiber.Ctx) error {
@@ -38,14 +44,19 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
 	}
 
-	err := h.service.UpdateUser(c.Context(), userIDStr, req)
+	err := h.service.UpdateUser(requestContext(c), userIDStr, req)
 	if err != nil {
+		if handled, rerr := passwordPolicyError(c, err); handled {
+			return rerr
+		}
 		// Podríamos afinar los status codes según el error (conflict vs internal),
 		// pero por simplicidad generalizamos o chequeamos mensajes string.
 		if err.Error() == "el email ya está en uso" || err.Error() == "el nombre de usuario ya está en uso" {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
 		}
-		if err.Error() == "ID inválido" || err.Error() == "las contraseñas no coinciden" {
+		if err.Error() == "ID inválido" || err.Error() == "las contraseñas no coinciden" || err.Error() == "email inválido" ||
+			strings.HasPrefix(err.Error(), "configuración de aportes inválida") ||
+			strings.HasPrefix(err.Error(), "configuración de deducciones inválida") {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -60,10 +71,172 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
 	}
 
-	err := h.service.DeleteUser(c.Context(), userIDStr)
+	scheduledAt, err := h.service.DeleteUser(requestContext(c), userIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	clearAuthCookies(c)
+	return c.JSON(fiber.Map{
+		"message":               "Cuenta programada para eliminación. Puedes restaurarla antes de la fecha indicada",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+// RestoreUser cancela el borrado programado de la cuenta (email, password y, con 2FA, code).
+func (h *UserHandler) RestoreUser(c *fiber.Ctx) error {
+	var req services.RestoreAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Error al parsear JSON"})
+	}
+
+	if err := h.service.RestoreUser(requestContext(c), req); err != nil {
+		switch err.Error() {
+		case "credenciales inválidas", "código de verificación inválido":
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		case "la cuenta no está pendiente de eliminación":
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case "el plazo para restaurar la cuenta ha terminado":
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Cuenta restaurada. Ya puedes iniciar sesión"})
+}
+
+// GetAuditLog lista la actividad de seguridad de la cuenta (?page=1&limit=20, máximo 100 por página).
+func (h *UserHandler) GetAuditLog(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "page inválido"})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit inválido"})
+	}
+
+	result, err := h.service.GetAuditLog(c.Context(), userIDStr, page, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+// sendArchive responde con el zip como descarga.
+func sendArchive(c *fiber.Ctx, result *services.ExportResult) error {
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+result.FileName+`"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(result.Archive)
+}
+
+// ExportData descarga todos los datos de la cuenta en un zip. Con historiales grandes (o ?async=true)
+// responde 202 con un trabajo en segundo plano y el enlace de descarga.
+func (h *UserHandler) ExportData(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	result, err := h.exports.Export(requestContext(c), userIDStr, c.QueryBool("async"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if result.Job == nil {
+		return sendArchive(c, result)
+	}
+
+	base := "/api/users/profile/export/" + result.Job.ID.Hex()
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":      "La exportación se está generando",
+		"job":          result.Job,
+		"status_url":   base,
+		"download_url": base + "/download",
+	})
+}
+
+// GetExportJob devuelve el estado de una exportación en segundo plano.
+func (h *UserHandler) GetExportJob(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	job, err := h.exports.GetJob(c.Context(), userIDStr, c.Params("job_id"))
+	if err != nil {
+		if err.Error() == "exportación no encontrada" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(job)
+}
+
+// DownloadExport descarga el archivo de una exportación terminada.
+func (h *UserHandler) DownloadExport(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	result, err := h.exports.DownloadJob(c.Context(), userIDStr, c.Params("job_id"))
 	if err != nil {
+		switch err.Error() {
+		case "exportación no encontrada":
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case "la exportación no está lista":
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	return sendArchive(c, result)
+}
 
-	return c.JSON(fiber.Map{"message": "Usuario y reportes asociados eliminados exitosamente"})
+// ImportBackup restaura los reportes de un zip exportado (campo multipart "file" o el cuerpo application/zip).
+// ?dry_run=true solo informa de lo que haría; ?conflict=skip|overwrite decide qué hacer con los meses existentes.
+func (h *UserHandler) ImportBackup(c *fiber.Ctx) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok || userIDStr == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Usuario no autenticado"})
+	}
+
+	var archive []byte
+	if fh, err := c.FormFile("file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No se pudo leer el archivo"})
+		}
+		defer f.Close()
+		if archive, err = io.ReadAll(f); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No se pudo leer el archivo"})
+		}
+	} else {
+		archive = c.Body()
+	}
+	if len(archive) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Archivo de respaldo no proporcionado"})
+	}
+
+	opts := services.ImportOptions{
+		DryRun:   c.QueryBool("dry_run"),
+		Conflict: c.Query("conflict"),
+	}
+	result, err := h.imports.ImportBackup(requestContext(c), userIDStr, archive, opts)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "archivo de respaldo inválido") ||
+			strings.HasPrefix(err.Error(), "versión de esquema no soportada") ||
+			strings.HasPrefix(err.Error(), "estrategia de conflicto inválida") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err.Error() == "el reporte se modificó al mismo tiempo, inténtalo de nuevo" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
 }
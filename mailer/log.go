@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogMailer no envía nada: escribe el correo en el log y, si Dir no está vacío,
+// también en un fichero .eml (útil en desarrollo local y en pruebas).
+type LogMailer struct {
+	Dir string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("[mailer] Para: %s | Asunto: %s\n%s", msg.To, msg.Subject, msg.Body)
+	if m.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	safeTo := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), safeTo)
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage("finances-api@localhost", msg), 0o644)
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/JimcostDev/finances-api/config"
+)
+
+// Message es un correo de texto plano.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer envía correos transaccionales (recuperación de contraseña, verificación, etc.).
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv elige la implementación según MAIL_DRIVER: "smtp" o "log" (por defecto).
+func NewFromEnv() Mailer {
+	switch strings.ToLower(os.Getenv("MAIL_DRIVER")) {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     config.EnvInt("SMTP_PORT", 587),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "", "log":
+		return &LogMailer{Dir: os.Getenv("MAIL_LOG_DIR")}
+	default:
+		log.Printf("MAIL_DRIVER %q no soportado, se usa \"log\"", os.Getenv("MAIL_DRIVER"))
+		return &LogMailer{Dir: os.Getenv("MAIL_LOG_DIR")}
+	}
+}
@@ -1,21 +1,32 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"strings"
 
 	"github.com/JimcostDev/finances-api/config"
+	"github.com/JimcostDev/finances-api/middleware"
+	"github.com/JimcostDev/finances-api/migrations"
 	"github.com/JimcostDev/finances-api/routes"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
 func main() {
-	// Tras proxy (p. ej. Koyeb), c.Protocol() y cookies Secure usan X-Forwarded-Proto
+	// Tras proxy (p. ej. Koyeb), X-Forwarded-For (IP del cliente) y X-Forwarded-Proto (cookies Secure)
+	// solo se aceptan si la conexión llega de uno de los TRUSTED_PROXIES
 	app := fiber.New(fiber.Config{
-		ProxyHeader: "X-Forwarded-Proto",
+		ProxyHeader:             fiber.HeaderXForwardedFor,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          middleware.TrustedProxies(),
+		EnableIPValidation:      true,
 	})
+	if len(middleware.TrustedProxies()) == 0 {
+		log.Println("TRUSTED_PROXIES sin configurar: se ignora X-Forwarded-For y se usa la IP de la conexión")
+	}
+	app.Use(middleware.WarnUntrustedForwarding())
 
 	// CORS: credenciales necesarias para cookies cross-origin (añade orígenes en CORS_ORIGINS separados por coma)
 	allowOrigins := os.Getenv("CORS_ORIGINS")
@@ -29,13 +40,19 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     strings.Join(parts, ","),
 		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-CSRF-Token, If-Match",
+		ExposeHeaders:    "X-CSRF-Token, Retry-After, ETag",
 		AllowCredentials: true,
 	}))
 
 	// Conectar a MongoDB.
 	config.ConnectDB()
 
+	// Aplicar migraciones de datos pendientes
+	if err := migrations.Run(context.Background(), config.DB); err != nil {
+		log.Fatal(err)
+	}
+
 	// Configurar las rutas
 	routes.SetupRoutes(app)
 
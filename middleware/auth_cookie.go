@@ -2,3 +2,9 @@ package middleware
 
 // AuthCookieName es el nombre de la cookie HttpOnly con el JWT (debe coincidir en login, logout y lectura).
 const AuthCookieName = "finances_access_token"
+
+// RefreshCookieName es la cookie HttpOnly con el refresh token; solo se envía a RefreshCookiePath.
+const RefreshCookieName = "finances_refresh_token"
+
+// RefreshCookiePath limita el refresh token a las rutas de autenticación.
+const RefreshCookiePath = "/api/auth"
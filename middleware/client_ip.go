@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// TrustedProxies lee TRUSTED_PROXIES (IPs o rangos CIDR separados por coma): los proxies
+// (Koyeb, balanceador...) de los que se aceptan X-Forwarded-For y X-Forwarded-Proto.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// trustedProxy indica si ip es uno de los proxies configurados.
+func trustedProxy(ip string, proxies []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, p := range proxies {
+		if strings.Contains(p, "/") {
+			if _, ipNet, err := net.ParseCIDR(p); err == nil && ipNet.Contains(parsed) {
+				return true
+			}
+		} else if parsed.Equal(net.ParseIP(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+var untrustedForwardedFor sync.Once
+
+// WarnUntrustedForwarding avisa en el log (una sola vez) si llega X-Forwarded-For desde una conexión que
+// no es de un proxy de confianza: la cabecera se ignora, así que detrás de un proxy sin TRUSTED_PROXIES
+// todos los clientes comparten la IP del proxy (y con ella los límites de intentos por IP).
+func WarnUntrustedForwarding() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get(fiber.HeaderXForwardedFor) != "" && !c.IsProxyTrusted() {
+			peer := c.Context().RemoteIP().String()
+			untrustedForwardedFor.Do(func() {
+				log.Printf("ADVERTENCIA: X-Forwarded-For desde %s, que no está en TRUSTED_PROXIES: se ignora y se usa la IP de la conexión. "+
+					"Si la API está detrás de un proxy, todos los clientes comparten su IP (y los límites de intentos); configura TRUSTED_PROXIES", peer)
+			})
+		}
+		return c.Next()
+	}
+}
+
+// ClientIP devuelve la IP del cliente. X-Forwarded-For solo se tiene en cuenta si la conexión viene
+// de un proxy de confianza (c.IP() con EnableTrustedProxyCheck); aun así el cliente puede escribir
+// las primeras entradas, así que se recorre de derecha a izquierda y se toma la primera IP que no
+// es un proxy configurado.
+func ClientIP(c *fiber.Ctx) string {
+	if !c.IsProxyTrusted() {
+		return c.Context().RemoteIP().String()
+	}
+	proxies := TrustedProxies()
+	ips := c.IPs()
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(ips[i])
+		if ip == "" || trustedProxy(ip, proxies) {
+			continue
+		}
+		return utils.CopyString(ip)
+	}
+	return utils.CopyString(c.IP())
+}
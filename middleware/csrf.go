@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CSRFHeaderName es la cabecera en la que el frontend reenvía el token anti-CSRF
+// recibido en login, refresh o /api/auth/me.
+const CSRFHeaderName = "X-CSRF-Token"
+
+// csrfSafeMethod indica si el método no modifica estado y por tanto no exige token anti-CSRF.
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// validCSRFToken compara en tiempo constante la cabecera con el token de la sesión.
+func validCSRFToken(c *fiber.Ctx, expected string) bool {
+	sent := c.Get(CSRFHeaderName)
+	return expected != "" && sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1
+}
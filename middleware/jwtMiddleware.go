@@ -1,19 +1,22 @@
 package middleware
 
 import (
-	"fmt"
-	"os"
 	"strings"
 
+	"github.com/JimcostDev/finances-api/services"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
 )
 
-// tokenFromRequest obtiene el JWT: primero cookie HttpOnly, luego Authorization Bearer (compatibilidad).
-func tokenFromRequest(c *fiber.Ctx) string {
+// TokenFromRequest obtiene el JWT: primero cookie HttpOnly, luego Authorization Bearer (compatibilidad).
+func TokenFromRequest(c *fiber.Ctx) string {
 	if t := c.Cookies(AuthCookieName); t != "" {
 		return t
 	}
+	return bearerToken(c)
+}
+
+// bearerToken devuelve el token de la cabecera Authorization: Bearer, o "" si no hay.
+func bearerToken(c *fiber.Ctx) string {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
 		return ""
@@ -25,47 +28,34 @@ func tokenFromRequest(c *fiber.Ctx) string {
 	return tokenString
 }
 
-// Protected es un middleware para verificar la autenticación con JWT.
-func Protected() fiber.Handler {
+// Protected es un middleware para verificar la autenticación con JWT o token personal (Bearer fpat_...).
+// Además de la firma, comprueba que la sesión del token ("sid") no haya sido revocada.
+// Si el token llega por cookie, las peticiones que modifican estado deben traer X-CSRF-Token
+// (el navegador adjunta la cookie en peticiones cross-site; la cabecera no). Bearer y tokens personales no lo necesitan.
+func Protected(auth services.AuthService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		tokenString := tokenFromRequest(c)
+		tokenString := TokenFromRequest(c)
 		if tokenString == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token no proporcionado"})
 		}
+		viaCookie := c.Cookies(AuthCookieName) != ""
 
-		// Leer la clave secreta desde las variables de entorno
-		secretKey := os.Getenv("JWT_SECRET_KEY")
-		if secretKey == "" {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "JWT_SECRET_KEY no configurada"})
-		}
-
-		// Verificar el token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("método de firma inválido")
-			}
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || !token.Valid {
+		principal, err := auth.Authenticate(c.Context(), tokenString)
+		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "No autorizado"})
 		}
 
-		// Extraer claims del token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Claims inválidas"})
-		}
-
-		// Obtener el ID del usuario y almacenarlo en c.Locals
-		userID, ok := claims["id"].(string)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "ID de usuario no válido en el token"})
+		if viaCookie && !csrfSafeMethod(c.Method()) && !validCSRFToken(c, principal.CSRFToken) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Token CSRF inválido o ausente"})
 		}
-		//fmt.Println("UserID extraído del token:", userID) // Para depuración
 
-		// Guardar el ID del usuario en c.Locals para usarlo en los controladores
-		c.Locals("userID", userID)
+		// Guardar el ID del usuario (y de la sesión) en c.Locals para usarlo en los controladores
+		c.Locals("userID", principal.UserID)
+		c.Locals("sessionID", principal.SessionID)
+		c.Locals("authMethod", principal.AuthMethod)
+		c.Locals("scope", principal.Scope)
+		c.Locals("csrfToken", principal.CSRFToken)
+		c.Locals("roles", principal.Roles)
 
 		// Continuar con la siguiente función en la cadena de middleware
 		return c.Next()
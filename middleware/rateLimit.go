@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/JimcostDev/finances-api/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TooManyRequests responde 429 con Retry-After (segundos, redondeado hacia arriba).
+func TooManyRequests(c *fiber.Ctx, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       "Demasiados intentos. Inténtalo de nuevo más tarde",
+		"retry_after": seconds,
+	})
+}
+
+// RateLimit limita por IP el número de peticiones a un endpoint (registro, recuperación de contraseña...).
+// Cada petición cuenta como intento; al superar la política se bloquea con backoff exponencial.
+func RateLimit(limiter *ratelimit.Limiter, name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := name + ":ip:" + ClientIP(c)
+
+		wait, err := limiter.Check(c.Context(), key)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if wait > 0 {
+			return TooManyRequests(c, wait)
+		}
+		if _, err := limiter.Hit(c.Context(), key); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope deja pasar solo lecturas (GET/HEAD) a los tokens personales de scope "read".
+// Va después de Protected en cada grupo de rutas.
+func RequireScope() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			return c.Next()
+		}
+		if scope, _ := c.Locals("scope").(string); scope != models.TokenScopeReadWrite {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "El token no tiene permiso de escritura"})
+		}
+		return c.Next()
+	}
+}
+
+// SessionOnly rechaza los tokens personales: gestión de tokens, sesiones, 2FA y cuenta
+// requieren haber iniciado sesión con contraseña.
+func SessionOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if method, _ := c.Locals("authMethod").(string); method != services.AuthMethodSession {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Esta operación requiere iniciar sesión"})
+		}
+		return c.Next()
+	}
+}
+
+// RequireRole deja pasar solo a usuarios con alguno de los roles indicados. Va después de Protected.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userRoles, _ := c.Locals("roles").([]string)
+		for _, have := range userRoles {
+			for _, want := range roles {
+				if have == want {
+					return c.Next()
+				}
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "No tienes permiso para esta operación"})
+	}
+}
@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// markExistingUsersEmailVerified: las cuentas creadas antes de la verificación de email
+// se consideran verificadas para que REQUIRE_EMAIL_VERIFICATION no las bloquee.
+func markExistingUsersEmailVerified(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").UpdateMany(ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	return err
+}
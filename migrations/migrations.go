@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration es un cambio de datos que se aplica una sola vez al arrancar.
+// Run debe ser idempotente: varias instancias pueden arrancar a la vez.
+type Migration struct {
+	ID  string
+	Run func(ctx context.Context, db *mongo.Database) error
+}
+
+// all se aplica en orden; nunca reordenar ni renombrar IDs ya desplegados.
+var all = []Migration{
+	{ID: "0001_existing_users_email_verified", Run: markExistingUsersEmailVerified},
+	{ID: "0002_canonical_report_periods", Run: canonicalizeReportPeriods},
+	{ID: "0003_report_amounts_in_cents", Run: convertReportAmountsToCents},
+	{ID: "0004_report_deductions", Run: backfillReportDeductions},
+	{ID: "0005_report_balances", Run: backfillReportBalances},
+}
+
+// Run aplica las migraciones pendientes y las registra en la colección "migrations".
+func Run(ctx context.Context, db *mongo.Database) error {
+	applied := db.Collection("migrations")
+	for _, m := range all {
+		count, err := applied.CountDocuments(ctx, bson.M{"_id": m.ID})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		log.Printf("Aplicando migración %s", m.ID)
+		if err := m.Run(ctx, db); err != nil {
+			return err
+		}
+		_, err = applied.UpdateOne(ctx,
+			bson.M{"_id": m.ID},
+			bson.M{"$setOnInsert": bson.M{"applied_at": time.Now()}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
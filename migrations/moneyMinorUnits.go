@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// convertReportAmountsToCents pasa los importes guardados como double (unidades) a int64 en centavos.
+// models.Money ya lee el formato antiguo al decodificar; aquí solo se reescribe el documento.
+func convertReportAmountsToCents(ctx context.Context, db *mongo.Database) error {
+	reports := db.Collection("reports")
+
+	double := bson.M{"$type": "double"}
+	filter := bson.M{"$or": bson.A{
+		bson.M{"ingresos.monto": double},
+		bson.M{"gastos.monto": double},
+		bson.M{"total_ingreso_bruto": double},
+		bson.M{"diezmos": double},
+		bson.M{"ofrendas": double},
+		bson.M{"iglesia": double},
+		bson.M{"ingresos_netos": double},
+		bson.M{"total_gastos": double},
+		bson.M{"liquidacion": double},
+	}}
+
+	cursor, err := reports.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var r models.Report
+		if err := cursor.Decode(&r); err != nil {
+			return err
+		}
+		set := bson.M{
+			"total_ingreso_bruto": r.TotalIngresoBruto,
+			"diezmos":             r.Diezmos,
+			"ofrendas":            r.Ofrendas,
+			"iglesia":             r.Iglesia,
+			"ingresos_netos":      r.IngresosNetos,
+			"total_gastos":        r.TotalGastos,
+			"liquidacion":         r.Liquidacion,
+		}
+		if r.Ingresos != nil {
+			set["ingresos"] = r.Ingresos
+		}
+		if r.Gastos != nil {
+			set["gastos"] = r.Gastos
+		}
+		if _, err := reports.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,108 @@
+package migrations
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Copia congelada del encadenado de saldos tal como era al añadir el arrastre: la migración debe dar
+// siempre el mismo resultado aunque services cambie después.
+
+// months0005 son los nombres canónicos de los meses (los dejó así 0002_canonical_report_periods).
+var months0005 = map[string]int{
+	"Enero": 1, "Febrero": 2, "Marzo": 3, "Abril": 4, "Mayo": 5, "Junio": 6,
+	"Julio": 7, "Agosto": 8, "Septiembre": 9, "Octubre": 10, "Noviembre": 11, "Diciembre": 12,
+}
+
+// balanceReport0005 son los campos del reporte que entran en el encadenado; nil = campo ausente.
+type balanceReport0005 struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	Month        string             `bson:"month"`
+	Year         int                `bson:"year"`
+	Cerrado      bool               `bson:"cerrado"`
+	Liquidacion  models.Money       `bson:"liquidacion"`
+	SaldoInicial *models.Money      `bson:"saldo_inicial"`
+	SaldoFinal   *models.Money      `bson:"saldo_final"`
+}
+
+func (r *balanceReport0005) period() int {
+	return r.Year*12 + months0005[r.Month] - 1
+}
+
+// backfillReportBalances encadena saldo_inicial y saldo_final de los usuarios con reportes guardados
+// antes de que existieran los saldos, con su configuración de arrastre actual. Con arrastre, el saldo
+// inicial de cada mes es el saldo final del reporte anterior; sin él, 0. Los cerrados conservan los suyos
+// (0 si no tenían) y la cadena sigue desde ellos.
+func backfillReportBalances(ctx context.Context, db *mongo.Database) error {
+	reports := db.Collection("reports")
+	userIDs, err := reports.Distinct(ctx, "user_id", bson.M{"$or": bson.A{
+		bson.M{"saldo_inicial": bson.M{"$exists": false}},
+		bson.M{"saldo_final": bson.M{"$exists": false}},
+	}})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range userIDs {
+		userID, ok := id.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		var user struct {
+			EnableCarryOver bool `bson:"enable_carry_over"`
+		}
+		err := db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			log.Printf("reportes del usuario %s sin usuario: se dejan sin saldos", userID.Hex())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		cursor, err := reports.Find(ctx, bson.M{"user_id": userID})
+		if err != nil {
+			return err
+		}
+		var list []balanceReport0005
+		if err := cursor.All(ctx, &list); err != nil {
+			return err
+		}
+		sort.SliceStable(list, func(i, j int) bool { return list[i].period() < list[j].period() })
+
+		var previous models.Money
+		for _, r := range list {
+			var inicial, final models.Money
+			if r.SaldoInicial != nil {
+				inicial = *r.SaldoInicial
+			}
+			if r.SaldoFinal != nil {
+				final = *r.SaldoFinal
+			}
+			if !r.Cerrado {
+				inicial = 0
+				if user.EnableCarryOver {
+					inicial = previous
+				}
+				final = inicial + r.Liquidacion
+			}
+			previous = final
+
+			unchanged := r.SaldoInicial != nil && r.SaldoFinal != nil && *r.SaldoInicial == inicial && *r.SaldoFinal == final
+			if unchanged {
+				continue
+			}
+			update := bson.M{"$set": bson.M{"saldo_inicial": inicial, "saldo_final": final}, "$inc": bson.M{"version": 1}}
+			if _, err := reports.UpdateOne(ctx, bson.M{"_id": r.ID}, update); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package migrations
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Copia congelada del cálculo de totales tal como era al añadir el desglose de deducciones: la
+// migración debe dar siempre el mismo resultado aunque services cambie después.
+
+// deductionsUser0004 es lo que el cálculo necesitaba del usuario.
+type deductionsUser0004 struct {
+	EnableChurchContributions bool `bson:"enable_church_contributions"`
+	ChurchSettings            *struct {
+		TitheRate           float64              `bson:"tithe_rate"`
+		TitheBase           string               `bson:"tithe_base"`
+		ExcludedCategoryIDs []primitive.ObjectID `bson:"excluded_category_ids"`
+		Contributions       []struct {
+			Name string  `bson:"name"`
+			Rate float64 `bson:"rate"`
+			Base string  `bson:"base"`
+		} `bson:"contributions"`
+	} `bson:"church_settings"`
+	Deductions []struct {
+		ID     primitive.ObjectID `bson:"_id"`
+		Name   string             `bson:"name"`
+		Type   string             `bson:"type"`
+		Rate   float64            `bson:"rate"`
+		Amount models.Money       `bson:"amount"`
+		Order  int                `bson:"order"`
+	} `bson:"deductions"`
+}
+
+// deductionsReport0004 son los campos del reporte que entran en el cálculo.
+type deductionsReport0004 struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Ingresos []struct {
+		Monto       models.Money        `bson:"monto"`
+		CategoriaID *primitive.ObjectID `bson:"categoria_id"`
+	} `bson:"ingresos"`
+	Gastos []struct {
+		Monto models.Money `bson:"monto"`
+	} `bson:"gastos"`
+	PorcentajeOfrenda float64      `bson:"porcentaje_ofrenda"`
+	SaldoInicial      models.Money `bson:"saldo_inicial"`
+}
+
+type appliedDeduction0004 struct {
+	RuleID string       `bson:"rule_id"`
+	Name   string       `bson:"name"`
+	Type   string       `bson:"type"`
+	Monto  models.Money `bson:"monto"`
+}
+
+type contribution0004 struct {
+	Name  string       `bson:"name"`
+	Monto models.Money `bson:"monto"`
+}
+
+func percent0004(m models.Money, rate float64) models.Money {
+	return models.Money(math.Round(float64(m) * rate))
+}
+
+// backfillReportDeductions recalcula los reportes abiertos guardados antes del desglose de deducciones,
+// para que tengan deducciones y total_deducciones. Los cerrados conservan las cifras con las que se
+// conciliaron. Los saldos no se tocan aquí (los encadena 0005_report_balances).
+func backfillReportDeductions(ctx context.Context, db *mongo.Database) error {
+	reports := db.Collection("reports")
+	pending := bson.M{
+		"cerrado":           bson.M{"$ne": true},
+		"total_deducciones": bson.M{"$exists": false},
+	}
+	userIDs, err := reports.Distinct(ctx, "user_id", pending)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range userIDs {
+		userID, ok := id.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		var user deductionsUser0004
+		err := db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			log.Printf("reportes del usuario %s sin usuario: se dejan sin recalcular", userID.Hex())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(user.Deductions, func(i, j int) bool { return user.Deductions[i].Order < user.Deductions[j].Order })
+
+		cursor, err := reports.Find(ctx, bson.M{"user_id": userID, "cerrado": bson.M{"$ne": true}})
+		if err != nil {
+			return err
+		}
+		var list []deductionsReport0004
+		if err := cursor.All(ctx, &list); err != nil {
+			return err
+		}
+		for i := range list {
+			set := deductionTotals0004(&list[i], &user)
+			update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+			if _, err := reports.UpdateOne(ctx, bson.M{"_id": list[i].ID}, update); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deductionTotals0004 calcula los totales del reporte: iglesia primero y después las reglas en orden.
+func deductionTotals0004(r *deductionsReport0004, u *deductionsUser0004) bson.M {
+	var bruto, gastos, totalDeducciones, diezmos, ofrendas, iglesia models.Money
+	for _, inc := range r.Ingresos {
+		bruto += inc.Monto
+	}
+	for _, exp := range r.Gastos {
+		gastos += exp.Monto
+	}
+	var deducciones []appliedDeduction0004
+	var contribuciones []contribution0004
+	add := func(d appliedDeduction0004) {
+		deducciones = append(deducciones, d)
+		totalDeducciones += d.Monto
+	}
+
+	if u.EnableChurchContributions {
+		titheRate, titheBase := 0.1, "gross"
+		var excluded []primitive.ObjectID
+		if s := u.ChurchSettings; s != nil {
+			titheRate, titheBase, excluded = s.TitheRate, s.TitheBase, s.ExcludedCategoryIDs
+		}
+		gross := bruto
+		for _, inc := range r.Ingresos {
+			if inc.CategoriaID == nil {
+				continue
+			}
+			for _, ex := range excluded {
+				if ex == *inc.CategoriaID {
+					gross -= inc.Monto
+					break
+				}
+			}
+		}
+		net := gross - gastos
+		if net < 0 {
+			net = 0
+		}
+		base := func(kind string) models.Money {
+			if kind == "net" {
+				return net
+			}
+			return gross
+		}
+
+		diezmos = percent0004(base(titheBase), titheRate)
+		ofrendas = percent0004(gross, r.PorcentajeOfrenda)
+		iglesia = diezmos + ofrendas
+		add(appliedDeduction0004{RuleID: "diezmo", Name: "Diezmo", Type: "church", Monto: diezmos})
+		add(appliedDeduction0004{RuleID: "ofrenda", Name: "Ofrenda", Type: "church", Monto: ofrendas})
+		if s := u.ChurchSettings; s != nil {
+			for _, c := range s.Contributions {
+				amount := percent0004(base(c.Base), c.Rate)
+				contribuciones = append(contribuciones, contribution0004{Name: c.Name, Monto: amount})
+				iglesia += amount
+				add(appliedDeduction0004{RuleID: "contribucion:" + c.Name, Name: c.Name, Type: "church", Monto: amount})
+			}
+		}
+	}
+
+	for _, rule := range u.Deductions {
+		var amount models.Money
+		switch rule.Type {
+		case "percent_gross":
+			amount = percent0004(bruto, rule.Rate)
+		case "percent_net":
+			remaining := bruto - totalDeducciones
+			if remaining < 0 {
+				remaining = 0
+			}
+			amount = percent0004(remaining, rule.Rate)
+		case "fixed":
+			amount = rule.Amount
+		default:
+			continue
+		}
+		add(appliedDeduction0004{RuleID: rule.ID.Hex(), Name: rule.Name, Type: rule.Type, Monto: amount})
+	}
+
+	netos := bruto - totalDeducciones
+	return bson.M{
+		"total_ingreso_bruto": bruto,
+		"diezmos":             diezmos,
+		"ofrendas":            ofrendas,
+		"iglesia":             iglesia,
+		"contribuciones":      contribuciones,
+		"deducciones":         deducciones,
+		"total_deducciones":   totalDeducciones,
+		"ingresos_netos":      netos,
+		"total_gastos":        gastos,
+		"liquidacion":         netos - gastos,
+		"saldo_final":         r.SaldoInicial + netos - gastos,
+		"updated_at":          time.Now(),
+	}
+}
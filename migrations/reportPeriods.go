@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// canonicalizeReportPeriods reescribe Report.Month con el nombre canónico del mes ("marzo", "03" → "Marzo")
+// y registra los periodos con más de un reporte del mismo usuario. Los duplicados no se tocan:
+// hay que resolverlos a mano (GET /api/admin/reports/duplicates) para que se cree el índice único.
+func canonicalizeReportPeriods(ctx context.Context, db *mongo.Database) error {
+	reports := db.Collection("reports")
+
+	cursor, err := reports.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"month": 1, "year": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var r struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Month string             `bson:"month"`
+			Year  int                `bson:"year"`
+		}
+		if err := cursor.Decode(&r); err != nil {
+			return err
+		}
+		month, err := models.ParseMonth(r.Month)
+		if err != nil {
+			log.Printf("reporte %s: mes %q no reconocido, se deja sin cambios", r.ID.Hex(), r.Month)
+			continue
+		}
+		canonical := models.MonthNames[month-1]
+		if canonical == r.Month {
+			continue
+		}
+		if _, err := reports.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": bson.M{"month": canonical}}); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	duplicates, err := repositories.NewReportRepository(db).FindDuplicatePeriods(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range duplicates {
+		log.Printf("reportes duplicados: usuario %s, %s %d: %v", d.UserID.Hex(), d.Month, d.Year, d.ReportIDs)
+	}
+	if len(duplicates) > 0 {
+		log.Printf("%d periodos con reportes duplicados: el índice único de reportes no se creará hasta resolverlos", len(duplicates))
+	}
+	return nil
+}
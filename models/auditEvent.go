@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tipos de evento del registro de auditoría de la cuenta
+const (
+	AuditLoginSucceeded             = "login_succeeded"
+	AuditLoginFailed                = "login_failed"
+	AuditLogout                     = "logout"
+	AuditSessionRevoked             = "session_revoked"
+	AuditPasswordChanged            = "password_changed"
+	AuditPasswordReset              = "password_reset"
+	AuditEmailChangeRequested       = "email_change_requested"
+	AuditEmailChanged               = "email_changed"
+	AuditChurchContributionsChanged = "church_contributions_changed"
+	AuditDeductionsChanged          = "deductions_changed"
+	AuditTwoFactorEnabled           = "two_factor_enabled"
+	AuditTwoFactorDisabled          = "two_factor_disabled"
+	AuditTokenCreated               = "token_created"
+	AuditTokenDeleted               = "token_deleted"
+	AuditAccountDeletionRequested   = "account_deletion_requested"
+	AuditAccountRestored            = "account_restored"
+	AuditAccountDeleted             = "account_deleted"
+	AuditDataExported               = "data_exported"
+	AuditDataImported               = "data_imported"
+
+	// Acciones de un administrador sobre la cuenta (details.by = ID del administrador)
+	AuditAccountDisabled    = "account_disabled"
+	AuditAccountEnabled     = "account_enabled"
+	AuditPasswordResetForce = "password_reset_forced"
+	AuditRolesChanged       = "roles_changed"
+)
+
+// AuditEvent es una entrada del registro de auditoría (solo se insertan, nunca se modifican).
+type AuditEvent struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID     `bson:"user_id" json:"user_id"`
+	Type      string                 `bson:"type" json:"type"`
+	IP        string                 `bson:"ip" json:"ip"`
+	UserAgent string                 `bson:"user_agent" json:"user_agent"`
+	Details   map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
+}
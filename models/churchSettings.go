@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Base sobre la que se calcula un aporte.
+const (
+	ContributionBaseGross = "gross" // Ingreso bruto (sin las categorías excluidas)
+	ContributionBaseNet   = "net"   // Bruto menos gastos del mes
+)
+
+// DefaultTitheRate: el diezmo clásico, 10 % del bruto.
+const DefaultTitheRate = 0.1
+
+const maxNamedContributions = 10
+
+// ChurchSettings configura los aportes a la iglesia de un usuario. Las tasas son fracciones (0.1 = 10 %),
+// como porcentaje_ofrenda. Sin configurar se aplica DefaultChurchSettings.
+type ChurchSettings struct {
+	TitheRate           float64              `bson:"tithe_rate" json:"tithe_rate"`
+	TitheBase           string               `bson:"tithe_base" json:"tithe_base"`
+	ExcludedCategoryIDs []primitive.ObjectID `bson:"excluded_category_ids,omitempty" json:"excluded_category_ids"` // Ingresos que no cuentan (p. ej. reembolsos)
+	Contributions       []NamedContribution  `bson:"contributions,omitempty" json:"contributions"`
+}
+
+// NamedContribution es un aporte adicional con nombre (misiones, construcción...).
+type NamedContribution struct {
+	Name string  `bson:"name" json:"name"`
+	Rate float64 `bson:"rate" json:"rate"`
+	Base string  `bson:"base" json:"base"`
+}
+
+// ContributionAmount es lo que un aporte con nombre supuso en un reporte.
+type ContributionAmount struct {
+	Name  string `bson:"name" json:"name"`
+	Monto Money  `bson:"monto" json:"monto"`
+}
+
+// DefaultChurchSettings reproduce el cálculo anterior: 10 % del bruto, sin exclusiones.
+func DefaultChurchSettings() ChurchSettings {
+	return ChurchSettings{TitheRate: DefaultTitheRate, TitheBase: ContributionBaseGross}
+}
+
+// ChurchSettingsOrDefault devuelve la configuración del usuario o la de por defecto.
+func (u *User) ChurchSettingsOrDefault() ChurchSettings {
+	if u.ChurchSettings == nil {
+		return DefaultChurchSettings()
+	}
+	return *u.ChurchSettings
+}
+
+func validContributionBase(base string) bool {
+	return base == ContributionBaseGross || base == ContributionBaseNet
+}
+
+// Normalize completa valores por defecto y valida la configuración.
+func (c *ChurchSettings) Normalize() error {
+	if c.TitheBase == "" {
+		c.TitheBase = ContributionBaseGross
+	}
+	if c.TitheRate < 0 || c.TitheRate > 1 {
+		return errors.New("configuración de aportes inválida: tithe_rate debe estar entre 0 y 1")
+	}
+	if !validContributionBase(c.TitheBase) {
+		return errors.New("configuración de aportes inválida: tithe_base debe ser gross o net")
+	}
+	if len(c.Contributions) > maxNamedContributions {
+		return errors.New("configuración de aportes inválida: máximo 10 aportes adicionales")
+	}
+	seen := map[string]bool{}
+	for i := range c.Contributions {
+		contrib := &c.Contributions[i]
+		contrib.Name = strings.TrimSpace(contrib.Name)
+		if contrib.Base == "" {
+			contrib.Base = ContributionBaseGross
+		}
+		key := strings.ToLower(contrib.Name)
+		switch {
+		case contrib.Name == "":
+			return errors.New("configuración de aportes inválida: cada aporte necesita un nombre")
+		case seen[key]:
+			return errors.New("configuración de aportes inválida: nombre de aporte repetido")
+		case contrib.Rate < 0 || contrib.Rate > 1:
+			return errors.New("configuración de aportes inválida: rate debe estar entre 0 y 1")
+		case !validContributionBase(contrib.Base):
+			return errors.New("configuración de aportes inválida: base debe ser gross o net")
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Excludes indica si los ingresos de esa categoría no cuentan para los aportes.
+func (c *ChurchSettings) Excludes(categoriaID *primitive.ObjectID) bool {
+	if categoriaID == nil {
+		return false
+	}
+	for _, id := range c.ExcludedCategoryIDs {
+		if id == *categoriaID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tipos de regla de deducción.
+const (
+	DeductionPercentGross = "percent_gross" // Porcentaje del bruto
+	DeductionPercentNet   = "percent_net"   // Porcentaje de lo que queda tras las deducciones anteriores
+	DeductionFixed        = "fixed"         // Importe fijo por reporte
+	DeductionChurch       = "church"        // Diezmo, ofrenda y aportes (solo en el desglose)
+)
+
+const maxDeductionRules = 20
+
+// DeductionRule es una deducción definida por el usuario (impuestos, pensión, ahorro "págate primero"...).
+// Se aplican después de los aportes a la iglesia, en orden ascendente de Order (1 o mayor).
+// La iglesia no es una regla más: su base es el bruto (sin las categorías excluidas) o el bruto menos
+// los gastos, nunca lo que dejan otras deducciones, así que va siempre primero (orden 0) y los
+// percent_net se calculan ya sin ella.
+type DeductionRule struct {
+	ID     primitive.ObjectID `bson:"_id" json:"id"`
+	Name   string             `bson:"name" json:"name"`
+	Type   string             `bson:"type" json:"type"`
+	Rate   float64            `bson:"rate,omitempty" json:"rate"`     // Fracción (0.1 = 10 %) para percent_*
+	Amount Money              `bson:"amount,omitempty" json:"amount"` // Para fixed
+	Order  int                `bson:"order" json:"order"`
+}
+
+// AppliedDeduction es lo que una regla (o un aporte a la iglesia) supuso en un reporte.
+type AppliedDeduction struct {
+	RuleID string `bson:"rule_id" json:"rule_id"` // ID de la regla, o "diezmo", "ofrenda", "contribucion:<nombre>"
+	Name   string `bson:"name" json:"name"`
+	Type   string `bson:"type" json:"type"`
+	Monto  Money  `bson:"monto" json:"monto"`
+}
+
+// NormalizeDeductionRules valida las reglas, asigna IDs a las nuevas y las deja ordenadas.
+func NormalizeDeductionRules(rules []DeductionRule) error {
+	if len(rules) > maxDeductionRules {
+		return errors.New("configuración de deducciones inválida: máximo 20 reglas")
+	}
+	seen := map[string]bool{}
+	for i := range rules {
+		rule := &rules[i]
+		rule.Name = strings.TrimSpace(rule.Name)
+		key := strings.ToLower(rule.Name)
+		switch {
+		case rule.Name == "":
+			return errors.New("configuración de deducciones inválida: cada regla necesita un nombre")
+		case seen[key]:
+			return errors.New("configuración de deducciones inválida: nombre de regla repetido")
+		case rule.Order < 1:
+			return errors.New("configuración de deducciones inválida: order debe ser 1 o mayor (los aportes a la iglesia van siempre primero)")
+		}
+		seen[key] = true
+
+		switch rule.Type {
+		case DeductionPercentGross, DeductionPercentNet:
+			if rule.Rate < 0 || rule.Rate > 1 {
+				return errors.New("configuración de deducciones inválida: rate debe estar entre 0 y 1")
+			}
+			rule.Amount = 0
+		case DeductionFixed:
+			if rule.Amount < 0 {
+				return errors.New("configuración de deducciones inválida: amount no puede ser negativo")
+			}
+			rule.Rate = 0
+		default:
+			return errors.New("configuración de deducciones inválida: type debe ser percent_gross, percent_net o fixed")
+		}
+		if rule.ID.IsZero() {
+			rule.ID = primitive.NewObjectID()
+		}
+	}
+	SortDeductionRules(rules)
+	return nil
+}
+
+// SortDeductionRules ordena por Order; a igual Order se respeta el orden en que se enviaron.
+func SortDeductionRules(rules []DeductionRule) {
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Order < rules[j].Order })
+}
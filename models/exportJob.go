@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Estados de una exportación en segundo plano
+const (
+	ExportStatusPending = "pending"
+	ExportStatusDone    = "done"
+	ExportStatusFailed  = "failed"
+)
+
+// ExportJob es una exportación de datos de la cuenta generada en segundo plano.
+// El archivo se guarda en GridFS (bucket "exports") hasta ExpiresAt.
+type ExportJob struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID      primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Status      string              `bson:"status" json:"status"`
+	FileID      *primitive.ObjectID `bson:"file_id,omitempty" json:"-"`
+	FileName    string              `bson:"file_name,omitempty" json:"file_name,omitempty"`
+	Size        int64               `bson:"size,omitempty" json:"size,omitempty"`
+	Error       string              `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	CompletedAt *time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	ExpiresAt   time.Time           `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// DateLayout es el formato de las fechas de calendario ("2024-03-15").
+const DateLayout = "2006-01-02"
+
+// ItemDate es cuándo ocurrió un ingreso o gasto: la fecha de calendario y, opcionalmente,
+// el instante exacto y la zona horaria en que se registró. Todo es opcional (items antiguos no la tienen).
+type ItemDate struct {
+	Fecha       string     `bson:"fecha,omitempty" json:"fecha,omitempty"`               // AAAA-MM-DD, dentro del mes del reporte
+	FechaHora   *time.Time `bson:"fecha_hora,omitempty" json:"fecha_hora,omitempty"`     // Instante (se guarda en UTC)
+	ZonaHoraria string     `bson:"zona_horaria,omitempty" json:"zona_horaria,omitempty"` // IANA, p. ej. "America/Bogota"
+}
+
+// Normalize valida la fecha contra el periodo del reporte. Si llega fecha_hora sin fecha, la fecha
+// se deriva de fecha_hora en su zona (zona_horaria o el desfase con que se envió).
+func (d *ItemDate) Normalize(period Period) error {
+	var loc *time.Location
+	if d.ZonaHoraria != "" {
+		l, err := time.LoadLocation(d.ZonaHoraria)
+		if err != nil {
+			return errors.New("zona horaria inválida")
+		}
+		loc = l
+	}
+
+	if d.FechaHora != nil {
+		local := *d.FechaHora
+		if loc != nil {
+			local = local.In(loc)
+		}
+		derived := local.Format(DateLayout)
+		if d.Fecha == "" {
+			d.Fecha = derived
+		} else if d.Fecha != derived {
+			return errors.New("fecha no coincide con fecha_hora")
+		}
+		utc := d.FechaHora.UTC()
+		d.FechaHora = &utc
+	}
+
+	if d.Fecha == "" {
+		return nil
+	}
+	date, err := time.Parse(DateLayout, d.Fecha)
+	if err != nil {
+		return errors.New("fecha inválida (AAAA-MM-DD)")
+	}
+	if date.Year() != period.Year || int(date.Month()) != period.Month {
+		return errors.New("fecha fuera del mes del reporte")
+	}
+	return nil
+}
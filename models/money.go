@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Money es una cantidad exacta en centavos. En JSON se sigue leyendo y escribiendo como número
+// decimal (12.5 → 1250) para no romper a los clientes; en Mongo se guarda como int64.
+type Money int64
+
+// MoneyFromFloat redondea a centavos (mitad hacia afuera, como el antiguo roundToTwoDecimals).
+func MoneyFromFloat(v float64) Money {
+	return Money(math.Round(v * 100))
+}
+
+// ParseMoney lee un decimal ("1234.5", "-0.015") sin pasar por float; más de dos decimales se redondean.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "eE") {
+		// Notación científica: no la envía ningún cliente, se acepta vía float
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, errors.New("importe inválido")
+		}
+		return MoneyFromFloat(f), nil
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, errors.New("importe inválido")
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	for _, part := range []string{whole, frac} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, errors.New("importe inválido")
+			}
+		}
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, errors.New("importe fuera de rango")
+	}
+	frac += "000"
+	cents := int64(frac[0]-'0')*10 + int64(frac[1]-'0')
+	if frac[2] >= '5' {
+		cents++
+	}
+	m := Money(units*100 + cents)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+// Float devuelve el importe en unidades (solo para mostrar o calcular porcentajes).
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// String formatea con dos decimales exactos: "1234.50".
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Percent aplica un porcentaje expresado como fracción (0.1 = 10 %) y redondea a centavos.
+func (m Money) Percent(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON acepta número o texto ("12.50").
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(int64(m))
+}
+
+// UnmarshalBSONValue lee centavos (int32/int64) y, por compatibilidad con los documentos
+// anteriores a la migración, un double o Decimal128 en unidades.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.Int64:
+		*m = Money(raw.Int64())
+	case bsontype.Int32:
+		*m = Money(raw.Int32())
+	case bsontype.Double:
+		*m = MoneyFromFloat(raw.Double())
+	case bsontype.Decimal128:
+		v, err := ParseMoney(raw.Decimal128().String())
+		if err != nil {
+			return err
+		}
+		*m = v
+	case bsontype.Null, bsontype.Undefined:
+		*m = 0
+	default:
+		return fmt.Errorf("no se puede leer un importe de tipo %s", t)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MonthNames es el nombre canónico de cada mes (índice 0 = enero) tal como se guarda en Report.Month.
+var MonthNames = [12]string{
+	"Enero", "Febrero", "Marzo", "Abril", "Mayo", "Junio",
+	"Julio", "Agosto", "Septiembre", "Octubre", "Noviembre", "Diciembre",
+}
+
+// Period es el mes (1-12) y año de un reporte. Solo puede haber un reporte por usuario y periodo.
+type Period struct {
+	Month int
+	Year  int
+}
+
+var errInvalidMonth = errors.New("mes inválido (1-12 o nombre del mes)")
+
+// ParseMonth acepta el número del mes ("3", "03") o su nombre en español sin importar mayúsculas ("marzo", "MARZO").
+func ParseMonth(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 12 {
+			return 0, errInvalidMonth
+		}
+		return n, nil
+	}
+	if s == "setiembre" {
+		return 9, nil
+	}
+	for i, name := range MonthNames {
+		if s == strings.ToLower(name) {
+			return i + 1, nil
+		}
+	}
+	return 0, errInvalidMonth
+}
+
+// ParsePeriod valida mes y año y devuelve el periodo canónico.
+func ParsePeriod(month string, year int) (Period, error) {
+	m, err := ParseMonth(month)
+	if err != nil {
+		return Period{}, err
+	}
+	if year < 1900 || year > 3000 {
+		return Period{}, errors.New("año inválido")
+	}
+	return Period{Month: m, Year: year}, nil
+}
+
+// MonthName devuelve el nombre canónico del mes del periodo.
+func (p Period) MonthName() string {
+	return MonthNames[p.Month-1]
+}
+
+// PeriodDuplicate agrupa los reportes de un mismo usuario y periodo creados antes del índice único.
+type PeriodDuplicate struct {
+	UserID    primitive.ObjectID   `bson:"user_id" json:"user_id"`
+	Year      int                  `bson:"year" json:"year"`
+	Month     string               `bson:"month" json:"month"`
+	ReportIDs []primitive.ObjectID `bson:"report_ids" json:"report_ids"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Alcances de los tokens personales.
+const (
+	TokenScopeRead      = "read"       // solo GET
+	TokenScopeReadWrite = "read_write" // lectura y escritura de reportes
+)
+
+// PersonalAccessToken es un token de larga duración para scripts e integraciones.
+// Solo se guarda el hash; Prefix permite reconocerlo en el listado.
+type PersonalAccessToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	Scope      string             `bson:"scope" json:"scope"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
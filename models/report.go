@@ -7,34 +7,45 @@ import (
 )
 
 type Income struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
 	CategoriaID *primitive.ObjectID `bson:"categoria_id,omitempty" json:"categoria_id,omitempty"`
-	Concepto    string             `bson:"concepto,omitempty" json:"concepto,omitempty"`
-	Monto    float64            `bson:"monto" json:"monto"`
+	Concepto    string              `bson:"concepto,omitempty" json:"concepto,omitempty"`
+	Monto       Money               `bson:"monto" json:"monto"`
+	ItemDate    `bson:",inline"`
 }
 
 type Expense struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
 	CategoriaID *primitive.ObjectID `bson:"categoria_id,omitempty" json:"categoria_id,omitempty"`
-	Concepto    string             `bson:"concepto,omitempty" json:"concepto,omitempty"`
-	Monto    float64            `bson:"monto" json:"monto"`
+	Concepto    string              `bson:"concepto,omitempty" json:"concepto,omitempty"`
+	Monto       Money               `bson:"monto" json:"monto"`
+	ItemDate    `bson:",inline"`
 }
 
 type Report struct {
-	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	UserID            primitive.ObjectID `bson:"user_id" json:"user_id"`
-	Month             string             `bson:"month" json:"month"`
-	Year              int                `bson:"year" json:"year"`
-	Ingresos          []Income           `bson:"ingresos" json:"ingresos"`
-	Gastos            []Expense          `bson:"gastos" json:"gastos"`
-	PorcentajeOfrenda float64            `bson:"porcentaje_ofrenda" json:"porcentaje_ofrenda"`
-	TotalIngresoBruto float64            `bson:"total_ingreso_bruto" json:"total_ingreso_bruto"`
-	Diezmos           float64            `bson:"diezmos" json:"diezmos"`
-	Ofrendas          float64            `bson:"ofrendas" json:"ofrendas"`
-	Iglesia           float64            `bson:"iglesia" json:"iglesia"`
-	IngresosNetos     float64            `bson:"ingresos_netos" json:"ingresos_netos"`
-	TotalGastos       float64            `bson:"total_gastos" json:"total_gastos"`
-	Liquidacion       float64            `bson:"liquidacion" json:"liquidacion"`
-	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+	ID                primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID            primitive.ObjectID   `bson:"user_id" json:"user_id"`
+	Month             string               `bson:"month" json:"month"`
+	Year              int                  `bson:"year" json:"year"`
+	Ingresos          []Income             `bson:"ingresos" json:"ingresos"`
+	Gastos            []Expense            `bson:"gastos" json:"gastos"`
+	PorcentajeOfrenda float64              `bson:"porcentaje_ofrenda" json:"porcentaje_ofrenda"`
+	TotalIngresoBruto Money                `bson:"total_ingreso_bruto" json:"total_ingreso_bruto"`
+	Diezmos           Money                `bson:"diezmos" json:"diezmos"`
+	Ofrendas          Money                `bson:"ofrendas" json:"ofrendas"`
+	Iglesia           Money                `bson:"iglesia" json:"iglesia"` // Diezmos + ofrendas + contribuciones
+	Contribuciones    []ContributionAmount `bson:"contribuciones,omitempty" json:"contribuciones,omitempty"`
+	Deducciones       []AppliedDeduction   `bson:"deducciones,omitempty" json:"deducciones,omitempty"` // Desglose: iglesia y reglas del usuario, en orden
+	TotalDeducciones  Money                `bson:"total_deducciones" json:"total_deducciones"`
+	IngresosNetos     Money                `bson:"ingresos_netos" json:"ingresos_netos"`
+	TotalGastos       Money                `bson:"total_gastos" json:"total_gastos"`
+	Liquidacion       Money                `bson:"liquidacion" json:"liquidacion"`
+	SaldoInicial      Money                `bson:"saldo_inicial" json:"saldo_inicial"` // Saldo final del mes anterior (con arrastre activo; si no, 0)
+	SaldoFinal        Money                `bson:"saldo_final" json:"saldo_final"`     // Saldo inicial + liquidación
+	Cerrado           bool                 `bson:"cerrado" json:"cerrado"`             // Mes conciliado: no admite cambios hasta reabrirlo
+	CerradoEn         *time.Time           `bson:"cerrado_en,omitempty" json:"cerrado_en,omitempty"`
+	Cierres           []ReportClosure      `bson:"cierres,omitempty" json:"cierres,omitempty"` // Historial de cierres y reaperturas
+	Version           int64                `bson:"version" json:"version"`                     // Se incrementa en cada escritura (control de concurrencia)
+	CreatedAt         time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time            `bson:"updated_at" json:"updated_at"`
 }
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Acciones del historial de cierre de un reporte.
+const (
+	ReportClosed   = "closed"
+	ReportReopened = "reopened"
+)
+
+// ReportClosure es una entrada del historial de cierres y reaperturas de un reporte.
+type ReportClosure struct {
+	Action string    `bson:"action" json:"action"`
+	Reason string    `bson:"reason,omitempty" json:"reason,omitempty"` // Obligatorio al reabrir
+	At     time.Time `bson:"at" json:"at"`
+}
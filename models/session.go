@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session es un inicio de sesión persistido. El refresh token solo se guarda como hash.
+type Session struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID           primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RefreshTokenHash string             `bson:"refresh_token_hash" json:"-"`
+	CSRFToken        string             `bson:"csrf_token,omitempty" json:"-"` // token anti-CSRF (synchronizer) de la sesión
+	UserAgent        string             `bson:"user_agent" json:"user_agent"`
+	IP               string             `bson:"ip" json:"ip"`
+	LastSeenAt       time.Time          `bson:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt        time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt        *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// IsActive indica si la sesión no fue revocada y no ha expirado.
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -6,13 +6,44 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Roles de usuario. Sin roles, el usuario solo accede a sus propios datos.
+const RoleAdmin = "admin"
+
+// ValidRoles son los roles que se pueden asignar desde la API de administración.
+var ValidRoles = []string{RoleAdmin}
+
 type User struct {
 	ID                        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	Email                     string             `bson:"email" json:"email"`
+	EmailVerified             bool               `bson:"email_verified" json:"email_verified"`
+	PendingEmail              string             `bson:"pending_email,omitempty" json:"pending_email,omitempty"` // Nuevo email a la espera de verificación
 	Username                  string             `bson:"username" json:"username"`
 	Password                  string             `bson:"password" json:"password"`
 	Fullname                  string             `bson:"fullname" json:"fullname"`
 	EnableChurchContributions bool               `bson:"enable_church_contributions" json:"enable_church_contributions"`
+	ChurchSettings            *ChurchSettings    `bson:"church_settings,omitempty" json:"church_settings,omitempty"` // Diezmo y aportes; nil = 10 % del bruto
+	Deductions                []DeductionRule    `bson:"deductions,omitempty" json:"deductions,omitempty"`           // Reglas de deducción propias, tras la iglesia
+	EnableCarryOver           bool               `bson:"enable_carry_over" json:"enable_carry_over"`                 // La liquidación de cada mes pasa como saldo inicial al siguiente
+	TwoFactorEnabled          bool               `bson:"two_factor_enabled" json:"two_factor_enabled"`               // TOTP; secretos y códigos de recuperación nunca van en el JSON
+	TwoFactorSecret           string             `bson:"two_factor_secret,omitempty" json:"-"`
+	TwoFactorPendingSecret    string             `bson:"two_factor_pending_secret,omitempty" json:"-"`
+	TwoFactorLastStep         int64              `bson:"two_factor_last_step,omitempty" json:"-"`
+	RecoveryCodeHashes        []string           `bson:"recovery_code_hashes,omitempty" json:"-"`
+	Roles                     []string           `bson:"roles,omitempty" json:"roles,omitempty"`
+	Disabled                  bool               `bson:"disabled,omitempty" json:"disabled,omitempty"`                               // Deshabilitada por un administrador: no puede iniciar sesión
+	PasswordResetRequired     bool               `bson:"password_reset_required,omitempty" json:"password_reset_required,omitempty"` // Forzado por un administrador
+	DeletionRequestedAt       *time.Time         `bson:"deletion_requested_at,omitempty" json:"deletion_requested_at,omitempty"`
+	DeletionScheduledAt       *time.Time         `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"` // Borrado definitivo a partir de esta fecha
 	CreatedAt                 time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt                 time.Time          `bson:"updated_at" json:"updated_at"`
 }
+
+// HasRole indica si el usuario tiene el rol indicado.
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
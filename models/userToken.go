@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Propósitos de los tokens de un solo uso enviados por correo.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFALogin          = "mfa_login" // jti del token "mfa pending" (no se envía por correo)
+)
+
+// UserToken es un token de un solo uso con caducidad; solo se guarda su hash.
+type UserToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Purpose   string             `bson:"purpose" json:"purpose"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	Email     string             `bson:"email,omitempty" json:"email,omitempty"` // Dirección que se verifica (email_verification)
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	Attempts  int                `bson:"attempts,omitempty" json:"-"` // Códigos fallidos (mfa_login)
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
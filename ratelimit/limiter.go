@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Policy define cuántos intentos se permiten y cómo crece el bloqueo.
+type Policy struct {
+	FreeAttempts int           // intentos permitidos antes del primer bloqueo
+	BaseDelay    time.Duration // duración del primer bloqueo; se duplica con cada intento extra
+	MaxDelay     time.Duration // tope del bloqueo
+	Window       time.Duration // sin intentos durante Window, el contador vuelve a cero
+}
+
+// lockout devuelve el bloqueo que corresponde a n intentos (0 si aún no hay bloqueo).
+func (p Policy) lockout(n int) time.Duration {
+	extra := n - p.FreeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < extra && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Entry es el estado de una clave (p. ej. "login:ip:1.2.3.4").
+type Entry struct {
+	Attempts    int
+	LockedUntil time.Time
+	ExpiresAt   time.Time
+}
+
+// Store persiste los contadores. Hit debe ser atómico para que varias peticiones
+// simultáneas no pierdan intentos.
+type Store interface {
+	Get(ctx context.Context, key string) (Entry, error)
+	Hit(ctx context.Context, key string, policy Policy, now time.Time) (Entry, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter aplica una Policy sobre un Store.
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy}
+}
+
+// Check devuelve cuánto falta para que termine el bloqueo más largo de las claves (0 = permitido).
+func (l *Limiter) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		entry, err := l.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if d := entry.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Hit registra un intento (fallido, o cualquier petición en endpoints limitados por volumen)
+// y devuelve el bloqueo resultante.
+func (l *Limiter) Hit(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		entry, err := l.store.Hit(ctx, key, l.policy, now)
+		if err != nil {
+			return 0, err
+		}
+		if d := entry.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Reset borra los contadores (p. ej. tras un login correcto).
+func (l *Limiter) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := l.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore guarda los contadores en memoria del proceso (una sola instancia).
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	hits    int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.ExpiresAt) {
+		return Entry{}, nil
+	}
+	return entry, nil
+}
+
+func (s *MemoryStore) Hit(ctx context.Context, key string, policy Policy, now time.Time) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.ExpiresAt) {
+		entry = Entry{}
+	}
+	entry.Attempts++
+	if d := policy.lockout(entry.Attempts); d > 0 {
+		entry.LockedUntil = now.Add(d)
+	}
+	entry.ExpiresAt = now.Add(policy.Window)
+	if entry.LockedUntil.After(entry.ExpiresAt) {
+		entry.ExpiresAt = entry.LockedUntil
+	}
+	s.entries[key] = entry
+
+	// Limpieza periódica de claves caducadas para que el mapa no crezca sin límite
+	s.hits++
+	if s.hits%1000 == 0 {
+		for k, e := range s.entries {
+			if now.After(e.ExpiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	return entry, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
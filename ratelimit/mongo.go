@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore comparte los contadores entre instancias (colección "auth_attempts").
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+type mongoEntry struct {
+	Key         string    `bson:"_id"`
+	Attempts    int       `bson:"attempts"`
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection("auth_attempts")}
+}
+
+func (s *MongoStore) Get(ctx context.Context, key string) (Entry, error) {
+	var doc mongoEntry
+	err := s.collection.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Entry{}, nil
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Attempts: doc.Attempts, LockedUntil: doc.LockedUntil, ExpiresAt: doc.ExpiresAt}, nil
+}
+
+func (s *MongoStore) Hit(ctx context.Context, key string, policy Policy, now time.Time) (Entry, error) {
+	// 1. Incremento atómico (reinicia a 1 si la entrada había caducado)
+	expired := bson.D{{Key: "$lte", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$expires_at", now}}}, now}}}
+	incr := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "attempts", Value: bson.D{{Key: "$cond", Value: bson.A{
+				expired,
+				1,
+				bson.D{{Key: "$add", Value: bson.A{"$attempts", 1}}},
+			}}}},
+			{Key: "locked_until", Value: bson.D{{Key: "$cond", Value: bson.A{
+				expired,
+				time.Time{},
+				"$locked_until",
+			}}}},
+			{Key: "expires_at", Value: bson.D{{Key: "$max", Value: bson.A{"$expires_at", now.Add(policy.Window)}}}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var doc mongoEntry
+	if err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, incr, opts).Decode(&doc); err != nil {
+		return Entry{}, err
+	}
+	entry := Entry{Attempts: doc.Attempts, LockedUntil: doc.LockedUntil, ExpiresAt: doc.ExpiresAt}
+
+	// 2. Bloqueo según el contador; $max evita acortar un bloqueo fijado por otra petición
+	if d := policy.lockout(doc.Attempts); d > 0 {
+		entry.LockedUntil = now.Add(d)
+		if entry.LockedUntil.After(entry.ExpiresAt) {
+			entry.ExpiresAt = entry.LockedUntil
+		}
+		_, err := s.collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$max": bson.M{
+			"locked_until": entry.LockedUntil,
+			"expires_at":   entry.ExpiresAt,
+		}})
+		if err != nil {
+			return Entry{}, err
+		}
+	}
+	return entry, nil
+}
+
+func (s *MongoStore) Reset(ctx context.Context, key string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// EnsureIndexes crea el índice TTL que borra las entradas caducadas.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
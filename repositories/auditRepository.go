@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepository gestiona la colección "audit_events". Es de solo inserción: no expone Update ni Delete.
+type AuditRepository interface {
+	Insert(ctx context.Context, event models.AuditEvent) (*mongo.InsertOneResult, error)
+	FindByUser(ctx context.Context, userID primitive.ObjectID, skip, limit int64) ([]models.AuditEvent, error)
+	CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type auditRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepository(db *mongo.Database) AuditRepository {
+	return &auditRepository{
+		collection: db.Collection("audit_events"),
+	}
+}
+
+// Insert añade un evento
+func (r *auditRepository) Insert(ctx context.Context, event models.AuditEvent) (*mongo.InsertOneResult, error) {
+	return r.collection.InsertOne(ctx, event)
+}
+
+// FindByUser devuelve una página de eventos del usuario (más recientes primero)
+func (r *auditRepository) FindByUser(ctx context.Context, userID primitive.ObjectID, skip, limit int64) ([]models.AuditEvent, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []models.AuditEvent
+	for cursor.Next(ctx) {
+		var event models.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// CountByUser cuenta los eventos del usuario (para la paginación)
+func (r *auditRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// DeleteAllByUserID borra los eventos de auditoría del usuario (borrado definitivo de la cuenta)
+func (r *auditRepository) DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+}
+
+// EnsureIndexes crea el índice por usuario y fecha que usa el listado paginado.
+func (r *auditRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
@@ -5,12 +5,16 @@ import (
 
 	"github.com/JimcostDev/finances-api/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type CategoryRepository interface {
 	FindAll(ctx context.Context) ([]models.Category, error)
+	ExistsByName(ctx context.Context, nombre, tipo string) (bool, error)
+	Create(ctx context.Context, category models.Category) (*mongo.InsertOneResult, error)
+	Delete(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error)
 }
 
 type categoryRepository struct {
@@ -42,3 +46,18 @@ func (r *categoryRepository) FindAll(ctx context.Context) ([]models.Category, er
 	return categories, nil
 }
 
+func (r *categoryRepository) ExistsByName(ctx context.Context, nombre, tipo string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"nombre": nombre, "tipo": tipo})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *categoryRepository) Create(ctx context.Context, category models.Category) (*mongo.InsertOneResult, error) {
+	return r.collection.InsertOne(ctx, category)
+}
+
+func (r *categoryRepository) Delete(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteOne(ctx, bson.M{"_id": oid})
+}
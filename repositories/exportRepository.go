@@ -0,0 +1,184 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExportRepository gestiona las exportaciones en segundo plano: la colección "export_jobs"
+// y los archivos generados en el bucket GridFS "exports".
+type ExportRepository interface {
+	Create(ctx context.Context, job models.ExportJob) (*mongo.InsertOneResult, error)
+	FindOne(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*models.ExportJob, error)
+	Update(ctx context.Context, oid primitive.ObjectID, update interface{}) (*mongo.UpdateResult, error)
+	FindExpired(ctx context.Context, now time.Time) ([]models.ExportJob, error)
+	Delete(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error)
+	DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+
+	UploadFile(ctx context.Context, name string, userID primitive.ObjectID, data []byte) (primitive.ObjectID, error)
+	DownloadFile(ctx context.Context, fileID primitive.ObjectID) ([]byte, error)
+	DeleteFile(ctx context.Context, fileID primitive.ObjectID) error
+	DeleteFilesByUserID(ctx context.Context, userID primitive.ObjectID) error
+
+	EnsureIndexes(ctx context.Context) error
+}
+
+type exportRepository struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+}
+
+func NewExportRepository(db *mongo.Database) ExportRepository {
+	return &exportRepository{
+		db:         db,
+		collection: db.Collection("export_jobs"),
+	}
+}
+
+// bucket crea el bucket GridFS por operación: los plazos (deadlines) del Bucket no son seguros entre goroutines.
+func (r *exportRepository) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(r.db, options.GridFSBucket().SetName("exports"))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = bucket.SetWriteDeadline(deadline)
+		_ = bucket.SetReadDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+// Create inserta una exportación
+func (r *exportRepository) Create(ctx context.Context, job models.ExportJob) (*mongo.InsertOneResult, error) {
+	return r.collection.InsertOne(ctx, job)
+}
+
+// FindOne busca una exportación del usuario
+func (r *exportRepository) FindOne(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := r.collection.FindOne(ctx, bson.M{"_id": oid, "user_id": userID}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Update actualiza una exportación por su ID
+func (r *exportRepository) Update(ctx context.Context, oid primitive.ObjectID, update interface{}) (*mongo.UpdateResult, error) {
+	return r.collection.UpdateOne(ctx, bson.M{"_id": oid}, update)
+}
+
+// FindExpired lista las exportaciones caducadas (para borrar también su archivo)
+func (r *exportRepository) FindExpired(ctx context.Context, now time.Time) ([]models.ExportJob, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var jobs []models.ExportJob
+	for cursor.Next(ctx) {
+		var job models.ExportJob
+		if err := cursor.Decode(&job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Delete elimina una exportación por su ID
+func (r *exportRepository) Delete(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteOne(ctx, bson.M{"_id": oid})
+}
+
+// DeleteAllByUserID borra las exportaciones del usuario (los archivos van aparte: DeleteFilesByUserID)
+func (r *exportRepository) DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+}
+
+// UploadFile guarda el archivo en GridFS con el usuario en metadata.user_id
+func (r *exportRepository) UploadFile(ctx context.Context, name string, userID primitive.ObjectID, data []byte) (primitive.ObjectID, error) {
+	bucket, err := r.bucket(ctx)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	opts := options.GridFSUpload().SetMetadata(bson.M{"user_id": userID})
+	return bucket.UploadFromStream(name, bytes.NewReader(data), opts)
+}
+
+// DownloadFile lee el archivo completo de GridFS
+func (r *exportRepository) DownloadFile(ctx context.Context, fileID primitive.ObjectID) ([]byte, error) {
+	bucket, err := r.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := bucket.DownloadToStream(fileID, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DeleteFile borra el archivo y sus chunks de GridFS
+func (r *exportRepository) DeleteFile(ctx context.Context, fileID primitive.ObjectID) error {
+	bucket, err := r.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	return bucket.DeleteContext(ctx, fileID)
+}
+
+// DeleteFilesByUserID borra de GridFS los archivos del usuario: los marcados con metadata.user_id
+// y los que referencian sus exportaciones (subidos antes de guardar el usuario en metadata).
+func (r *exportRepository) DeleteFilesByUserID(ctx context.Context, userID primitive.ObjectID) error {
+	bucket, err := r.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	fileIDs, err := r.collection.Distinct(ctx, "file_id", bson.M{"user_id": userID, "file_id": bson.M{"$ne": nil}})
+	if err != nil {
+		return err
+	}
+	cursor, err := bucket.FindContext(ctx, bson.M{"metadata.user_id": userID})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var file struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&file); err != nil {
+			return err
+		}
+		fileIDs = append(fileIDs, file.ID)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range fileIDs {
+		if err := bucket.DeleteContext(ctx, id); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureIndexes crea el índice por usuario y el de caducidad.
+func (r *exportRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}},
+	})
+	return err
+}
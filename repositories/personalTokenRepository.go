@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PersonalTokenRepository gestiona la colección "personal_access_tokens".
+type PersonalTokenRepository interface {
+	Create(ctx context.Context, token models.PersonalAccessToken) (*mongo.InsertOneResult, error)
+	FindByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	FindAllByUser(ctx context.Context, userID primitive.ObjectID) ([]models.PersonalAccessToken, error)
+	Touch(ctx context.Context, oid primitive.ObjectID, lastUsedAt time.Time) (*mongo.UpdateResult, error)
+	Delete(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+	DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type personalTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPersonalTokenRepository(db *mongo.Database) PersonalTokenRepository {
+	return &personalTokenRepository{
+		collection: db.Collection("personal_access_tokens"),
+	}
+}
+
+// Create inserta un nuevo token personal
+func (r *personalTokenRepository) Create(ctx context.Context, token models.PersonalAccessToken) (*mongo.InsertOneResult, error) {
+	return r.collection.InsertOne(ctx, token)
+}
+
+// FindByHash busca un token por el hash del valor presentado
+func (r *personalTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// FindAllByUser lista los tokens del usuario (más recientes primero)
+func (r *personalTokenRepository) FindAllByUser(ctx context.Context, userID primitive.ObjectID) ([]models.PersonalAccessToken, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []models.PersonalAccessToken
+	for cursor.Next(ctx) {
+		var token models.PersonalAccessToken
+		if err := cursor.Decode(&token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// Touch registra el último uso del token
+func (r *personalTokenRepository) Touch(ctx context.Context, oid primitive.ObjectID, lastUsedAt time.Time) (*mongo.UpdateResult, error) {
+	return r.collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"last_used_at": lastUsedAt}})
+}
+
+// Delete revoca (elimina) un token del usuario
+func (r *personalTokenRepository) Delete(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteOne(ctx, bson.M{"_id": oid, "user_id": userID})
+}
+
+// DeleteAllByUserID borra los tokens personales del usuario (borrado definitivo de la cuenta)
+func (r *personalTokenRepository) DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+}
+
+// EnsureIndexes: búsqueda por hash (única) y listado por usuario.
+func (r *personalTokenRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	return err
+}
@@ -14,12 +14,21 @@ import (
 type ReportRepository interface {
 	Create(ctx context.Context, report models.Report) (*mongo.InsertOneResult, error)
 	Update(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID, update interface{}) (*mongo.UpdateResult, error)
+	UpdateIfVersion(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID, version int64, update bson.M) (*mongo.UpdateResult, error)
+	UpdateOpenIfVersion(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID, version int64, update bson.M) (*mongo.UpdateResult, error)
+	UpdateAndFetch(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID, version int64, cond bson.M, update bson.M) (*models.Report, error)
 	FindAll(ctx context.Context, userID primitive.ObjectID) ([]models.Report, error)
 	FindOne(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*models.Report, error)
 	FindByMonth(ctx context.Context, userID primitive.ObjectID, month string, year int) ([]models.Report, error)
 	Delete(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+	DeleteIfOpen(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*mongo.DeleteResult, error)
 	AggregateReports(ctx context.Context, pipeline mongo.Pipeline) ([]bson.M, error)
 	DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+	CountAll(ctx context.Context) (int64, error)
+	CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	ExistsForPeriod(ctx context.Context, userID primitive.ObjectID, month string, year int, excludeID primitive.ObjectID) (bool, error)
+	FindDuplicatePeriods(ctx context.Context) ([]models.PeriodDuplicate, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 type reportRepository struct {
@@ -42,6 +51,51 @@ func (r *reportRepository) Update(ctx context.Context, oid primitive.ObjectID, u
 	return r.collection.UpdateOne(ctx, filter, update)
 }
 
+// UpdateIfVersion aplica update solo si el reporte sigue en la versión leída e incrementa la versión.
+// MatchedCount == 0 significa que otra escritura se adelantó (o que el reporte no existe).
+func (r *reportRepository) UpdateIfVersion(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID, version int64, update bson.M) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": oid, "user_id": userID, "version": version}
+	if version == 0 {
+		// Reportes anteriores al campo version
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	update["$inc"] = bson.M{"version": 1}
+	return r.collection.UpdateOne(ctx, filter, update)
+}
+
+// UpdateOpenIfVersion es UpdateIfVersion que además exige que el reporte no esté cerrado.
+func (r *reportRepository) UpdateOpenIfVersion(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID, version int64, update bson.M) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": oid, "user_id": userID, "version": version, "cerrado": bson.M{"$ne": true}}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	update["$inc"] = bson.M{"version": 1}
+	return r.collection.UpdateOne(ctx, filter, update)
+}
+
+// UpdateAndFetch aplica update si el reporte cumple cond (y está en version; con version < 0 no se
+// comprueba), incrementa la versión y devuelve el documento ya actualizado en la misma operación.
+// mongo.ErrNoDocuments si no cumple el filtro.
+func (r *reportRepository) UpdateAndFetch(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID, version int64, cond bson.M, update bson.M) (*models.Report, error) {
+	filter := bson.M{"_id": oid, "user_id": userID}
+	for k, v := range cond {
+		filter[k] = v
+	}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else if version > 0 {
+		filter["version"] = version
+	}
+	update["$inc"] = bson.M{"version": 1}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var report models.Report
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
 func (r *reportRepository) FindAll(ctx context.Context, userID primitive.ObjectID) ([]models.Report, error) {
 	filter := bson.M{"user_id": userID}
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
@@ -94,6 +148,12 @@ func (r *reportRepository) Delete(ctx context.Context, oid primitive.ObjectID, u
 	return r.collection.DeleteOne(ctx, filter)
 }
 
+// DeleteIfOpen borra el reporte solo si no está cerrado. DeletedCount == 0 si no existe o está cerrado.
+func (r *reportRepository) DeleteIfOpen(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	filter := bson.M{"_id": oid, "user_id": userID, "cerrado": bson.M{"$ne": true}}
+	return r.collection.DeleteOne(ctx, filter)
+}
+
 func (r *reportRepository) AggregateReports(ctx context.Context, pipeline mongo.Pipeline) ([]bson.M, error) {
 	cursor, err := r.collection.Aggregate(ctx, pipeline)
 	if err != nil {
@@ -110,3 +170,66 @@ func (r *reportRepository) DeleteAllByUserID(ctx context.Context, userID primiti
 	// Borra TODOS los documentos en la colección 'reports' que coincidan con el user_id
 	return r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
 }
+
+// CountAll cuenta los reportes de todos los usuarios (estadísticas de administración)
+func (r *reportRepository) CountAll(ctx context.Context) (int64, error) {
+	return r.collection.EstimatedDocumentCount(ctx)
+}
+
+// CountByUser cuenta los reportes del usuario
+func (r *reportRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// ExistsForPeriod indica si el usuario ya tiene un reporte de ese mes y año (sin contar excludeID).
+func (r *reportRepository) ExistsForPeriod(ctx context.Context, userID primitive.ObjectID, month string, year int, excludeID primitive.ObjectID) (bool, error) {
+	filter := bson.M{"user_id": userID, "month": month, "year": year}
+	if !excludeID.IsZero() {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FindDuplicatePeriods lista los periodos con más de un reporte del mismo usuario.
+// Mientras existan, no se puede crear el índice único.
+func (r *reportRepository) FindDuplicatePeriods(ctx context.Context) ([]models.PeriodDuplicate, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "user_id", Value: "$user_id"}, {Key: "year", Value: "$year"}, {Key: "month", Value: "$month"}}},
+			{Key: "report_ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "user_id", Value: "$_id.user_id"},
+			{Key: "year", Value: "$_id.year"},
+			{Key: "month", Value: "$_id.month"},
+			{Key: "report_ids", Value: 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "user_id", Value: 1}, {Key: "year", Value: 1}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	duplicates := []models.PeriodDuplicate{}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
+
+// EnsureIndexes crea el índice único de un reporte por usuario y periodo.
+// Falla mientras haya duplicados anteriores (ver FindDuplicatePeriods); se reintenta en cada arranque.
+func (r *reportRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "year", Value: 1}, {Key: "month", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("user_period_unique"),
+	})
+	return err
+}
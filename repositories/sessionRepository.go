@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionRepository gestiona la colección "sessions" (sesiones con refresh token).
+type SessionRepository interface {
+	Create(ctx context.Context, session models.Session) (*mongo.InsertOneResult, error)
+	FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Session, error)
+	FindActiveByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error)
+	RotateRefreshToken(ctx context.Context, oid primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) (*mongo.UpdateResult, error)
+	Touch(ctx context.Context, oid primitive.ObjectID, lastSeenAt time.Time) (*mongo.UpdateResult, error)
+	SetCSRFToken(ctx context.Context, oid primitive.ObjectID, token string) (*mongo.UpdateResult, error)
+	Revoke(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*mongo.UpdateResult, error)
+	RevokeAllByUser(ctx context.Context, userID primitive.ObjectID, except primitive.ObjectID) (*mongo.UpdateResult, error)
+	CountActive(ctx context.Context) (int64, error)
+	DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type sessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSessionRepository(db *mongo.Database) SessionRepository {
+	return &sessionRepository{
+		collection: db.Collection("sessions"),
+	}
+}
+
+// Create inserta una nueva sesión
+func (r *sessionRepository) Create(ctx context.Context, session models.Session) (*mongo.InsertOneResult, error) {
+	return r.collection.InsertOne(ctx, session)
+}
+
+// FindByID busca una sesión por su ObjectID
+func (r *sessionRepository) FindByID(ctx context.Context, oid primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	err := r.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindActiveByUser lista las sesiones no revocadas ni expiradas de un usuario (más recientes primero)
+func (r *sessionRepository) FindActiveByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.Session
+	for cursor.Next(ctx) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// RotateRefreshToken reemplaza el hash del refresh token solo si sigue siendo oldHash
+// (compare-and-swap: dos renovaciones simultáneas con el mismo token no pueden ganar ambas).
+func (r *sessionRepository) RotateRefreshToken(ctx context.Context, oid primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) (*mongo.UpdateResult, error) {
+	filter := bson.M{
+		"_id":                oid,
+		"refresh_token_hash": oldHash,
+		"revoked_at":         bson.M{"$exists": false},
+	}
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"refresh_token_hash": newHash,
+		"expires_at":         expiresAt,
+		"last_seen_at":       now,
+		"updated_at":         now,
+	}}
+	return r.collection.UpdateOne(ctx, filter, update)
+}
+
+// Touch actualiza la última actividad de la sesión
+func (r *sessionRepository) Touch(ctx context.Context, oid primitive.ObjectID, lastSeenAt time.Time) (*mongo.UpdateResult, error) {
+	return r.collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{"last_seen_at": lastSeenAt}})
+}
+
+// SetCSRFToken asigna el token anti-CSRF solo si la sesión aún no tiene uno (sesiones anteriores a CSRF)
+func (r *sessionRepository) SetCSRFToken(ctx context.Context, oid primitive.ObjectID, token string) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": oid, "csrf_token": bson.M{"$exists": false}}
+	return r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"csrf_token": token}})
+}
+
+// Revoke marca la sesión del usuario como revocada (el documento se conserva hasta que expira)
+func (r *sessionRepository) Revoke(ctx context.Context, oid primitive.ObjectID, userID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	now := time.Now()
+	filter := bson.M{"_id": oid, "user_id": userID, "revoked_at": bson.M{"$exists": false}}
+	return r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": now, "updated_at": now}})
+}
+
+// RevokeAllByUser revoca todas las sesiones activas del usuario salvo except (NilObjectID = ninguna)
+func (r *sessionRepository) RevokeAllByUser(ctx context.Context, userID primitive.ObjectID, except primitive.ObjectID) (*mongo.UpdateResult, error) {
+	now := time.Now()
+	filter := bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}}
+	if !except.IsZero() {
+		filter["_id"] = bson.M{"$ne": except}
+	}
+	return r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": now, "updated_at": now}})
+}
+
+// CountActive cuenta las sesiones no revocadas ni expiradas de todos los usuarios
+func (r *sessionRepository) CountActive(ctx context.Context) (int64, error) {
+	filter := bson.M{
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	return r.collection.CountDocuments(ctx, filter)
+}
+
+// DeleteAllByUserID borra todas las sesiones del usuario (borrado definitivo de la cuenta)
+func (r *sessionRepository) DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+}
+
+// EnsureIndexes crea el índice TTL que elimina las sesiones expiradas y el índice por usuario.
+func (r *sessionRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	return err
+}
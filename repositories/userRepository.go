@@ -2,11 +2,13 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/JimcostDev/finances-api/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // UserRepository define todas las operaciones de base de datos para usuarios
@@ -14,6 +16,7 @@ type UserRepository interface {
 	// Métodos usados por Auth
 	Create(ctx context.Context, user models.User) (*mongo.InsertOneResult, error)
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	FindByPendingEmail(ctx context.Context, email string) (*models.User, error)
 	ExistsByEmailOrUsername(ctx context.Context, email, username string) (bool, error)
 
 	// Métodos usados por User Profile
@@ -21,6 +24,12 @@ type UserRepository interface {
 	FindByUsername(ctx context.Context, username string) (*models.User, error)
 	Update(ctx context.Context, oid primitive.ObjectID, update interface{}) (*mongo.UpdateResult, error)
 	Delete(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error)
+	FindDeletionDue(ctx context.Context, now time.Time) ([]models.User, error)
+
+	// Métodos usados por Admin
+	Search(ctx context.Context, filter interface{}, skip, limit int64) ([]models.User, error)
+	Count(ctx context.Context, filter interface{}) (int64, error)
+	AddRoleByEmail(ctx context.Context, email, role string) (*mongo.UpdateResult, error)
 }
 
 type userRepository struct {
@@ -50,11 +59,22 @@ func (r *userRepository) FindByEmail(ctx context.Context, email string) (*models
 	return &user, nil
 }
 
-// ExistsByEmailOrUsername verifica si ya existe un usuario con ese email o username
+// FindByPendingEmail busca el usuario que tiene ese email pendiente de verificación
+func (r *userRepository) FindByPendingEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, bson.M{"pending_email": email}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ExistsByEmailOrUsername verifica si ya existe un usuario con ese email (activo o pendiente) o username
 func (r *userRepository) ExistsByEmailOrUsername(ctx context.Context, email, username string) (bool, error) {
 	filter := bson.M{
 		"$or": []bson.M{
 			{"email": email},
+			{"pending_email": email},
 			{"username": username},
 		},
 	}
@@ -94,3 +114,56 @@ func (r *userRepository) Update(ctx context.Context, oid primitive.ObjectID, upd
 func (r *userRepository) Delete(ctx context.Context, oid primitive.ObjectID) (*mongo.DeleteResult, error) {
 	return r.collection.DeleteOne(ctx, bson.M{"_id": oid})
 }
+
+// FindDeletionDue lista los usuarios pendientes de eliminación cuyo plazo de restauración ya terminó
+func (r *userRepository) FindDeletionDue(ctx context.Context, now time.Time) ([]models.User, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"deletion_scheduled_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// Search devuelve una página de usuarios que cumplen el filtro (más recientes primero)
+func (r *userRepository) Search(ctx context.Context, filter interface{}, skip, limit int64) ([]models.User, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// Count cuenta los usuarios que cumplen el filtro
+func (r *userRepository) Count(ctx context.Context, filter interface{}) (int64, error) {
+	return r.collection.CountDocuments(ctx, filter)
+}
+
+// AddRoleByEmail añade un rol al usuario con ese email, solo si el email está verificado
+func (r *userRepository) AddRoleByEmail(ctx context.Context, email, role string) (*mongo.UpdateResult, error) {
+	filter := bson.M{"email": email, "email_verified": true}
+	return r.collection.UpdateOne(ctx, filter, bson.M{"$addToSet": bson.M{"roles": role}})
+}
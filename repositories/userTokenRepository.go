@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserTokenRepository gestiona la colección "user_tokens" (tokens de un solo uso enviados por correo).
+type UserTokenRepository interface {
+	Create(ctx context.Context, token models.UserToken) (*mongo.InsertOneResult, error)
+	FindValid(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error)
+	MarkUsed(ctx context.Context, oid primitive.ObjectID) (*mongo.UpdateResult, error)
+	InvalidateAll(ctx context.Context, userID primitive.ObjectID, purpose string) (*mongo.UpdateResult, error)
+	RecordFailure(ctx context.Context, oid primitive.ObjectID, maxAttempts int) error
+	DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type userTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewUserTokenRepository(db *mongo.Database) UserTokenRepository {
+	return &userTokenRepository{
+		collection: db.Collection("user_tokens"),
+	}
+}
+
+// Create inserta un nuevo token
+func (r *userTokenRepository) Create(ctx context.Context, token models.UserToken) (*mongo.InsertOneResult, error) {
+	return r.collection.InsertOne(ctx, token)
+}
+
+// FindValid busca un token no usado y no expirado por su hash
+func (r *userTokenRepository) FindValid(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	filter := bson.M{
+		"purpose":    purpose,
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	var token models.UserToken
+	if err := r.collection.FindOne(ctx, filter).Decode(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed consume el token; MatchedCount == 0 significa que otro request ya lo usó
+func (r *userTokenRepository) MarkUsed(ctx context.Context, oid primitive.ObjectID) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": oid, "used_at": bson.M{"$exists": false}}
+	return r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": time.Now()}})
+}
+
+// InvalidateAll consume todos los tokens pendientes del usuario para ese propósito
+func (r *userTokenRepository) InvalidateAll(ctx context.Context, userID primitive.ObjectID, purpose string) (*mongo.UpdateResult, error) {
+	filter := bson.M{"user_id": userID, "purpose": purpose, "used_at": bson.M{"$exists": false}}
+	return r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"used_at": time.Now()}})
+}
+
+// RecordFailure suma un intento fallido y consume el token al llegar a maxAttempts
+func (r *userTokenRepository) RecordFailure(ctx context.Context, oid primitive.ObjectID, maxAttempts int) error {
+	filter := bson.M{"_id": oid, "used_at": bson.M{"$exists": false}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var token models.UserToken
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"attempts": 1}}, opts).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if token.Attempts >= maxAttempts {
+		_, err = r.MarkUsed(ctx, oid)
+	}
+	return err
+}
+
+// DeleteAllByUserID borra los tokens de un solo uso (verificación, recuperación, 2FA) del usuario (borrado definitivo de la cuenta)
+func (r *userTokenRepository) DeleteAllByUserID(ctx context.Context, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	return r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+}
+
+// EnsureIndexes: búsqueda por hash y TTL para borrar los tokens expirados.
+func (r *userTokenRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/JimcostDev/finances-api/handlers"
+	"github.com/JimcostDev/finances-api/middleware"
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminRoutes registra la API de administración: solo sesiones (no tokens personales) con rol admin.
+func AdminRoutes(app *fiber.App, handler *handlers.AdminHandler, protected fiber.Handler) {
+	api := app.Group("/api/admin", protected, middleware.SessionOnly(), middleware.RequireRole(models.RoleAdmin))
+
+	api.Get("/stats", handler.GetStats)
+	api.Get("/reports/duplicates", handler.ListDuplicateReports)
+
+	api.Get("/users", handler.ListUsers)
+	api.Get("/users/:id", handler.GetUser)
+	api.Post("/users/:id/disable", handler.DisableUser)
+	api.Post("/users/:id/enable", handler.EnableUser)
+	api.Post("/users/:id/force-password-reset", handler.ForcePasswordReset)
+	api.Put("/users/:id/roles", handler.SetUserRoles)
+
+	api.Post("/categories", handler.CreateCategory)
+	api.Delete("/categories/:id", handler.DeleteCategory)
+}
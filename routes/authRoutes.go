@@ -3,15 +3,44 @@ package routes
 import (
 	"github.com/JimcostDev/finances-api/handlers"
 	"github.com/JimcostDev/finances-api/middleware"
+	"github.com/JimcostDev/finances-api/ratelimit"
 	"github.com/gofiber/fiber/v2"
 )
 
 // AuthRoutes ahora recibe el AuthHandler
-func AuthRoutes(app *fiber.App, handler *handlers.AuthHandler) {
+func AuthRoutes(app *fiber.App, handler *handlers.AuthHandler, protected fiber.Handler, throttle *ratelimit.Limiter) {
+	// Claves públicas para que otros servicios verifiquen nuestros JWT
+	app.Get("/.well-known/jwks.json", handler.JWKS)
+
 	api := app.Group("api/auth")
 
-	api.Post("/register", handler.Register)
+	api.Post("/register", middleware.RateLimit(throttle, "register"), handler.Register)
 	api.Post("/login", handler.Login)
+	api.Post("/login/2fa", handler.LoginMFA)
+	api.Post("/refresh", handler.Refresh)
 	api.Post("/logout", handler.Logout)
-	api.Get("/me", middleware.Protected(), handler.Me)
+	api.Post("/forgot-password", middleware.RateLimit(throttle, "forgot-password"), handler.ForgotPassword)
+	api.Post("/reset-password", middleware.RateLimit(throttle, "reset-password"), handler.ResetPassword)
+	api.Post("/verify-email", middleware.RateLimit(throttle, "verify-email"), handler.VerifyEmail)
+	api.Post("/resend-verification", middleware.RateLimit(throttle, "resend-verification"), handler.ResendVerification)
+	api.Get("/me", protected, handler.Me)
+
+	// Lo siguiente requiere una sesión iniciada: un token personal no puede gestionar credenciales
+	session := []fiber.Handler{protected, middleware.SessionOnly()}
+
+	// Sesiones activas / dispositivos
+	api.Get("/sessions", append(session, handler.ListSessions)...)
+	api.Post("/sessions/revoke-others", append(session, handler.RevokeOtherSessions)...)
+	api.Delete("/sessions/:id", append(session, handler.RevokeSession)...)
+
+	// Verificación en dos pasos (TOTP)
+	api.Post("/2fa/setup", append(session, handler.SetupTwoFactor)...)
+	api.Post("/2fa/enable", append(session, handler.EnableTwoFactor)...)
+	api.Post("/2fa/disable", append(session, handler.DisableTwoFactor)...)
+	api.Post("/2fa/recovery-codes", append(session, handler.RegenerateRecoveryCodes)...)
+
+	// Tokens personales (scripts e integraciones)
+	api.Get("/tokens", append(session, handler.ListPersonalTokens)...)
+	api.Post("/tokens", append(session, handler.CreatePersonalToken)...)
+	api.Delete("/tokens/:id", append(session, handler.DeletePersonalToken)...)
 }
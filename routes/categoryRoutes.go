@@ -6,8 +6,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func CategoryRoutes(app *fiber.App, handler *handlers.CategoryHandler) {
-	api := app.Group("/api/categories", middleware.Protected())
+func CategoryRoutes(app *fiber.App, handler *handlers.CategoryHandler, protected fiber.Handler) {
+	api := app.Group("/api/categories", protected, middleware.RequireScope())
 	api.Get("/", handler.GetCategories)
 }
 
@@ -6,8 +6,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func ReportRoutes(app *fiber.App, handler *handlers.ReportHandler) {
-	api := app.Group("/api/reports", middleware.Protected())
+func ReportRoutes(app *fiber.App, handler *handlers.ReportHandler, protected fiber.Handler) {
+	api := app.Group("/api/reports", protected, middleware.RequireScope())
 
 	// 1. Balance General (Histórico de todos los tiempos)
 	api.Get("/general-balance", handler.GetGeneralBalance)
@@ -17,6 +17,7 @@ func ReportRoutes(app *fiber.App, handler *handlers.ReportHandler) {
 
 	// 3. Filtros y Listados
 	api.Get("/by-month", handler.GetReportsByMonth)
+	api.Get("/cash-flow", handler.GetCashFlow)
 	api.Get("/", handler.GetReports)
 	api.Post("/", handler.CreateReport)
 
@@ -25,9 +26,15 @@ func ReportRoutes(app *fiber.App, handler *handlers.ReportHandler) {
 	api.Put("/:id", handler.UpdateReport)
 	api.Delete("/:id", handler.DeleteReport)
 
+	// Cierre de periodos conciliados
+	api.Post("/:id/close", handler.CloseReport)
+	api.Post("/:id/reopen", handler.ReopenReport)
+
 	// Endpoints para modificar ingresos y gastos dentro de un reporte
 	api.Post("/:id/income", handler.AddIncome)
+	api.Patch("/:id/income/:income_id", handler.UpdateIncome)
 	api.Delete("/:id/income/:income_id", handler.RemoveIncome)
 	api.Post("/:id/expense", handler.AddExpense)
+	api.Patch("/:id/expense/:expense_id", handler.UpdateExpense)
 	api.Delete("/:id/expense/:expense_id", handler.RemoveExpense)
 }
@@ -1,8 +1,16 @@
 package routes
 
 import (
+	"context"
+	"log"
+	"os"
+	"time"
+
 	"github.com/JimcostDev/finances-api/config"
 	"github.com/JimcostDev/finances-api/handlers"
+	"github.com/JimcostDev/finances-api/mailer"
+	"github.com/JimcostDev/finances-api/middleware"
+	"github.com/JimcostDev/finances-api/ratelimit"
 	"github.com/JimcostDev/finances-api/repositories"
 	"github.com/JimcostDev/finances-api/services"
 	"github.com/gofiber/fiber/v2"
@@ -13,20 +21,106 @@ func SetupRoutes(app *fiber.App) {
 	dbClient := config.DB.Client()
 
 	userRepo := repositories.NewUserRepository(config.DB)
-	authService := services.NewAuthService(userRepo)
+	sessionRepo := repositories.NewSessionRepository(config.DB)
+	userTokenRepo := repositories.NewUserTokenRepository(config.DB)
+	personalTokenRepo := repositories.NewPersonalTokenRepository(config.DB)
+	jwtKeys, err := services.LoadJWTKeySet()
+	if err != nil {
+		log.Fatal(err)
+	}
+	auditRepo := repositories.NewAuditRepository(config.DB)
+	exportRepo := repositories.NewExportRepository(config.DB)
+	auditService := services.NewAuditService(auditRepo)
+	authService := services.NewAuthService(userRepo, sessionRepo, userTokenRepo, personalTokenRepo, mailer.NewFromEnv(), jwtKeys, auditService)
 	reportRepo := repositories.NewReportRepository(config.DB)
-	reportService := services.NewReportService(reportRepo, userRepo)
-	userService := services.NewUserService(userRepo, reportRepo, dbClient, reportService)
-	authHandler := handlers.NewAuthHandler(authService, userService)
+	reportService := services.NewReportService(reportRepo, userRepo, dbClient)
+	userService := services.NewUserService(userRepo, reportRepo, sessionRepo, services.AccountDataRepositories{
+		PersonalTokens: personalTokenRepo,
+		UserTokens:     userTokenRepo,
+		Audit:          auditRepo,
+		Exports:        exportRepo,
+	}, dbClient, reportService, authService, authService, auditService)
+	attemptStore := newAttemptStore()
+	loginLimiter := ratelimit.New(attemptStore, ratelimit.Policy{
+		FreeAttempts: config.EnvInt("LOGIN_FREE_ATTEMPTS", 5),
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     time.Hour,
+		Window:       15 * time.Minute,
+	})
+	// Códigos 2FA fallidos por cuenta: tras MFA_MAX_FAILURES la cuenta queda bloqueada (15 min, duplicándose hasta 24 h)
+	mfaLimiter := ratelimit.New(attemptStore, ratelimit.Policy{
+		FreeAttempts: config.EnvInt("MFA_MAX_FAILURES", 5),
+		BaseDelay:    15 * time.Minute,
+		MaxDelay:     24 * time.Hour,
+		Window:       24 * time.Hour,
+	})
+	// Registro y recuperación de contraseña: límite por volumen de peticiones por IP
+	throttle := ratelimit.New(attemptStore, ratelimit.Policy{
+		FreeAttempts: config.EnvInt("SENSITIVE_FREE_REQUESTS", 10),
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	})
+	authHandler := handlers.NewAuthHandler(authService, userService, loginLimiter, mfaLimiter)
 	reportHandler := handlers.NewReportHandler(reportService)
 	categoryRepo := repositories.NewCategoryRepository(config.DB)
 	categoryService := services.NewCategoryService(categoryRepo)
 	categoryHandler := handlers.NewCategoryHandler(categoryService)
 
-	userHandler := handlers.NewUserHandler(userService)
+	exportService := services.NewExportService(userRepo, reportRepo, auditRepo, exportRepo, auditService)
+	importService := services.NewImportService(userRepo, reportRepo, categoryRepo, dbClient, auditService)
+	userHandler := handlers.NewUserHandler(userService, exportService, importService)
+
+	adminService := services.NewAdminService(userRepo, reportRepo, sessionRepo, authService, auditService)
+	adminHandler := handlers.NewAdminHandler(adminService, categoryService)
+
+	ensureIndexes(sessionRepo, userTokenRepo, personalTokenRepo, auditRepo, exportRepo, reportRepo)
+	bootstrapAdmins(adminService)
+
+	// Borrado definitivo de cuentas tras el plazo de gracia y de exportaciones caducadas
+	// (ACCOUNT_PURGE_INTERVAL_MINUTES, 60 por defecto)
+	purgeInterval := time.Duration(config.EnvInt("ACCOUNT_PURGE_INTERVAL_MINUTES", 60)) * time.Minute
+	go services.RunAccountPurger(context.Background(), userService, exportService, purgeInterval)
+
+	protected := middleware.Protected(authService)
+
+	AuthRoutes(app, authHandler, protected, throttle)
+	ReportRoutes(app, reportHandler, protected)
+	CategoryRoutes(app, categoryHandler, protected)
+	UserRoutes(app, userHandler, protected, throttle)
+	AdminRoutes(app, adminHandler, protected)
+}
+
+// bootstrapAdmins aplica ADMIN_EMAILS al arrancar.
+func bootstrapAdmins(admins services.AdminService) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	admins.BootstrapAdmins(ctx)
+}
+
+// newAttemptStore elige dónde se cuentan los intentos: "memory" (por defecto, una instancia)
+// o "mongo" (compartido entre instancias) según RATE_LIMIT_STORE.
+func newAttemptStore() ratelimit.Store {
+	if os.Getenv("RATE_LIMIT_STORE") == "mongo" {
+		store := ratelimit.NewMongoStore(config.DB)
+		ensureIndexes(store)
+		return store
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// indexEnsurer lo implementan los repositorios que necesitan índices propios.
+type indexEnsurer interface {
+	EnsureIndexes(ctx context.Context) error
+}
 
-	AuthRoutes(app, authHandler)
-	ReportRoutes(app, reportHandler)
-	CategoryRoutes(app, categoryHandler)
-	UserRoutes(app, userHandler)
+// ensureIndexes crea los índices al arrancar; un fallo solo se registra para no impedir el arranque.
+func ensureIndexes(repos ...indexEnsurer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, r := range repos {
+		if err := r.EnsureIndexes(ctx); err != nil {
+			log.Printf("no se pudieron crear índices: %v", err)
+		}
+	}
 }
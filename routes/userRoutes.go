@@ -3,13 +3,26 @@ package routes
 import (
 	"github.com/JimcostDev/finances-api/handlers"
 	"github.com/JimcostDev/finances-api/middleware"
+	"github.com/JimcostDev/finances-api/ratelimit"
 	"github.com/gofiber/fiber/v2"
 )
 
-func UserRoutes(app *fiber.App, handler *handlers.UserHandler) {
-	api := app.Group("/api/users", middleware.Protected())
+func UserRoutes(app *fiber.App, handler *handlers.UserHandler, protected fiber.Handler, throttle *ratelimit.Limiter) {
+	// Restaurar una cuenta pendiente de eliminación: el login está bloqueado, así que va con credenciales
+	// y se registra antes del grupo para que no le aplique el middleware Protected.
+	app.Post("/api/users/profile/restore", middleware.RateLimit(throttle, "restore-account"), handler.RestoreUser)
+
+	api := app.Group("/api/users", protected, middleware.RequireScope())
 
 	api.Get("/profile", handler.GetUserProfile)
-	api.Put("/profile", handler.UpdateUser)
-	api.Delete("/profile", handler.DeleteUser)
+	api.Get("/audit-log", handler.GetAuditLog)
+	// Cambiar credenciales o borrar la cuenta no se permite con tokens personales
+	api.Put("/profile", middleware.SessionOnly(), handler.UpdateUser)
+	api.Delete("/profile", middleware.SessionOnly(), handler.DeleteUser)
+
+	// Exportación completa de datos (portabilidad); no disponible con tokens personales
+	api.Get("/profile/export", middleware.SessionOnly(), handler.ExportData)
+	api.Get("/profile/export/:job_id", middleware.SessionOnly(), handler.GetExportJob)
+	api.Get("/profile/export/:job_id/download", middleware.SessionOnly(), handler.DownloadExport)
+	api.Post("/profile/import-backup", middleware.SessionOnly(), handler.ImportBackup)
 }
@@ -0,0 +1,414 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/JimcostDev/finances-api/config"
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// ExportSchemaVersion es la versión del formato del archivo de exportación (manifest.json).
+// Se incrementa con cada cambio de la estructura de los ficheros; la importación acepta también las
+// anteriores (upgradeBackup):
+//
+//	1: formato inicial
+//	2: fecha, fecha_hora y zona_horaria en ingresos y gastos
+//	3: deducciones (settings.deductions; deducciones y total_deducciones en cada reporte)
+//	4: arrastre de saldos (settings.enable_carry_over; saldo_inicial y saldo_final)
+//	5: cierre de periodos (cerrado, cerrado_en y cierres)
+const ExportSchemaVersion = 5
+
+// ExportManifest describe el contenido del archivo de exportación.
+type ExportManifest struct {
+	SchemaVersion int       `json:"schema_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+	UserID        string    `json:"user_id"`
+	Reports       int       `json:"reports"`
+	Files         []string  `json:"files"`
+}
+
+// ExportSettings son las preferencias del usuario que afectan a los cálculos.
+type ExportSettings struct {
+	EnableChurchContributions bool                   `json:"enable_church_contributions"`
+	ChurchSettings            models.ChurchSettings  `json:"church_settings"`
+	Deductions                []models.DeductionRule `json:"deductions"`
+	EnableCarryOver           bool                   `json:"enable_carry_over"`
+}
+
+// ExportProfile es el perfil que va en profile.json: solo datos de la cuenta, nunca el hash de la
+// contraseña ni secretos de 2FA (las preferencias van en settings.json).
+type ExportProfile struct {
+	ID                  primitive.ObjectID `json:"id"`
+	Email               string             `json:"email"`
+	EmailVerified       bool               `json:"email_verified"`
+	PendingEmail        string             `json:"pending_email,omitempty"`
+	Username            string             `json:"username"`
+	Fullname            string             `json:"fullname"`
+	TwoFactorEnabled    bool               `json:"two_factor_enabled"`
+	Roles               []string           `json:"roles,omitempty"`
+	DeletionScheduledAt *time.Time         `json:"deletion_scheduled_at,omitempty"`
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
+}
+
+func exportProfile(u *models.User) ExportProfile {
+	return ExportProfile{
+		ID:                  u.ID,
+		Email:               u.Email,
+		EmailVerified:       u.EmailVerified,
+		PendingEmail:        u.PendingEmail,
+		Username:            u.Username,
+		Fullname:            u.Fullname,
+		TwoFactorEnabled:    u.TwoFactorEnabled,
+		Roles:               u.Roles,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+		CreatedAt:           u.CreatedAt,
+		UpdatedAt:           u.UpdatedAt,
+	}
+}
+
+// ExportResult: Archive con el zip si se generó al momento, o Job si se genera en segundo plano.
+type ExportResult struct {
+	Archive  []byte
+	FileName string
+	Job      *models.ExportJob
+}
+
+// ExportService genera la exportación completa de los datos de la cuenta (portabilidad).
+type ExportService interface {
+	// Export genera el zip al momento, o en segundo plano si el historial es grande o async es true.
+	Export(ctx context.Context, userIDStr string, async bool) (*ExportResult, error)
+	GetJob(ctx context.Context, userIDStr, jobIDStr string) (*models.ExportJob, error)
+	DownloadJob(ctx context.Context, userIDStr, jobIDStr string) (*ExportResult, error)
+	// CleanupExpired borra las exportaciones caducadas y sus archivos; devuelve cuántas borró.
+	CleanupExpired(ctx context.Context) (int, error)
+}
+
+type exportService struct {
+	userRepo   repositories.UserRepository
+	reportRepo repositories.ReportRepository
+	auditRepo  repositories.AuditRepository
+	exports    repositories.ExportRepository
+	audit      AuditService
+}
+
+func NewExportService(uRepo repositories.UserRepository, rRepo repositories.ReportRepository, auditRepo repositories.AuditRepository, exports repositories.ExportRepository, audit AuditService) ExportService {
+	return &exportService{
+		userRepo:   uRepo,
+		reportRepo: rRepo,
+		auditRepo:  auditRepo,
+		exports:    exports,
+		audit:      audit,
+	}
+}
+
+// exportSyncMaxReports: por encima de este número de reportes la exportación va en segundo plano
+// (EXPORT_SYNC_MAX_REPORTS, 120 por defecto).
+func exportSyncMaxReports() int64 {
+	return int64(config.EnvInt("EXPORT_SYNC_MAX_REPORTS", 120))
+}
+
+// exportJobTTL: tiempo que se conserva el archivo generado en segundo plano (EXPORT_JOB_TTL_HOURS, 24 por defecto).
+func exportJobTTL() time.Duration {
+	return time.Duration(config.EnvInt("EXPORT_JOB_TTL_HOURS", 24)) * time.Hour
+}
+
+func exportFileName(now time.Time) string {
+	return fmt.Sprintf("myfinances-export-%s.zip", now.Format("20060102-150405"))
+}
+
+func (s *exportService) Export(ctx context.Context, userIDStr string, async bool) (*ExportResult, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+	count, err := s.reportRepo.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !async && count <= exportSyncMaxReports() {
+		archive, err := s.buildArchive(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		s.audit.Record(ctx, userID, models.AuditDataExported, map[string]interface{}{"reports": count})
+		return &ExportResult{Archive: archive, FileName: exportFileName(time.Now())}, nil
+	}
+
+	now := time.Now()
+	job := models.ExportJob{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Status:    models.ExportStatusPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(exportJobTTL()),
+	}
+	if _, err := s.exports.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, userID, models.AuditDataExported, map[string]interface{}{"reports": count, "job_id": job.ID.Hex()})
+
+	// El contexto de la petición termina al responder: el trabajo usa uno propio
+	go s.runJob(job)
+	return &ExportResult{Job: &job}, nil
+}
+
+// runJob genera el archivo de una exportación en segundo plano y lo guarda en GridFS.
+func (s *exportService) runJob(job models.ExportJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	fail := func(err error) {
+		log.Printf("error en la exportación %s: %v", job.ID.Hex(), err)
+		_, _ = s.exports.Update(ctx, job.ID, bson.M{"$set": bson.M{
+			"status": models.ExportStatusFailed,
+			"error":  "no se pudo generar la exportación",
+		}})
+	}
+
+	archive, err := s.buildArchive(ctx, job.UserID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	name := exportFileName(job.CreatedAt)
+	fileID, err := s.exports.UploadFile(ctx, name, job.UserID, archive)
+	if err != nil {
+		fail(err)
+		return
+	}
+	now := time.Now()
+	_, err = s.exports.Update(ctx, job.ID, bson.M{"$set": bson.M{
+		"status":       models.ExportStatusDone,
+		"file_id":      fileID,
+		"file_name":    name,
+		"size":         int64(len(archive)),
+		"completed_at": now,
+	}})
+	if err != nil {
+		fail(err)
+	}
+}
+
+// CleanupExpired lo llama el purgador periódico. Si no se puede borrar el archivo de una
+// exportación, esta se conserva para reintentarlo en la siguiente pasada.
+func (s *exportService) CleanupExpired(ctx context.Context) (int, error) {
+	jobs, err := s.exports.FindExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, job := range jobs {
+		if job.FileID != nil {
+			if err := s.exports.DeleteFile(ctx, *job.FileID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+				log.Printf("no se pudo borrar el archivo de la exportación %s: %v", job.ID.Hex(), err)
+				continue
+			}
+		}
+		if _, err := s.exports.Delete(ctx, job.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (s *exportService) findJob(ctx context.Context, userIDStr, jobIDStr string) (*models.ExportJob, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+	jobID, err := primitive.ObjectIDFromHex(jobIDStr)
+	if err != nil {
+		return nil, errors.New("exportación no encontrada")
+	}
+	job, err := s.exports.FindOne(ctx, jobID, userID)
+	if err != nil || !time.Now().Before(job.ExpiresAt) {
+		return nil, errors.New("exportación no encontrada")
+	}
+	return job, nil
+}
+
+func (s *exportService) GetJob(ctx context.Context, userIDStr, jobIDStr string) (*models.ExportJob, error) {
+	return s.findJob(ctx, userIDStr, jobIDStr)
+}
+
+func (s *exportService) DownloadJob(ctx context.Context, userIDStr, jobIDStr string) (*ExportResult, error) {
+	job, err := s.findJob(ctx, userIDStr, jobIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.ExportStatusDone || job.FileID == nil {
+		return nil, errors.New("la exportación no está lista")
+	}
+	archive, err := s.exports.DownloadFile(ctx, *job.FileID)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportResult{Archive: archive, FileName: job.FileName, Job: job}, nil
+}
+
+// buildArchive genera el zip: manifest, perfil y preferencias (JSON), reportes con sus ingresos y gastos
+// (JSON y CSV) y el registro de auditoría (JSON y CSV).
+func (s *exportService) buildArchive(ctx context.Context, userID primitive.ObjectID) ([]byte, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+	reports, err := s.reportRepo.FindAll(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if reports == nil {
+		reports = []models.Report{}
+	}
+	events, err := s.auditRepo.FindByUser(ctx, userID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []models.AuditEvent{}
+	}
+
+	files := []struct {
+		name  string
+		build func() ([]byte, error)
+	}{
+		{"profile.json", func() ([]byte, error) { return json.MarshalIndent(exportProfile(user), "", "  ") }},
+		{"settings.json", func() ([]byte, error) {
+			return json.MarshalIndent(ExportSettings{
+				EnableChurchContributions: user.EnableChurchContributions,
+				ChurchSettings:            user.ChurchSettingsOrDefault(),
+				Deductions:                user.Deductions,
+				EnableCarryOver:           user.EnableCarryOver,
+			}, "", "  ")
+		}},
+		{"reports.json", func() ([]byte, error) { return json.MarshalIndent(reports, "", "  ") }},
+		{"reports.csv", func() ([]byte, error) { return reportsCSV(reports) }},
+		{"incomes.csv", func() ([]byte, error) { return itemsCSV(reports, true) }},
+		{"expenses.csv", func() ([]byte, error) { return itemsCSV(reports, false) }},
+		{"audit_events.json", func() ([]byte, error) { return json.MarshalIndent(events, "", "  ") }},
+		{"audit_events.csv", func() ([]byte, error) { return auditCSV(events) }},
+	}
+
+	manifest := ExportManifest{
+		SchemaVersion: ExportSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		UserID:        userID.Hex(),
+		Reports:       len(reports),
+	}
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, f.name)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := write("manifest.json", data); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, err := f.build()
+		if err != nil {
+			return nil, err
+		}
+		if err := write(f.name, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCSV(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func reportsCSV(reports []models.Report) ([]byte, error) {
+	rows := [][]string{{
+		"id", "month", "year", "porcentaje_ofrenda", "total_ingreso_bruto", "diezmos", "ofrendas", "iglesia",
+		"total_deducciones", "ingresos_netos", "total_gastos", "liquidacion", "saldo_inicial", "saldo_final", "created_at", "updated_at",
+	}}
+	for _, r := range reports {
+		rows = append(rows, []string{
+			r.ID.Hex(), r.Month, strconv.Itoa(r.Year), strconv.FormatFloat(r.PorcentajeOfrenda, 'f', -1, 64),
+			r.TotalIngresoBruto.String(), r.Diezmos.String(), r.Ofrendas.String(), r.Iglesia.String(),
+			r.TotalDeducciones.String(), r.IngresosNetos.String(), r.TotalGastos.String(), r.Liquidacion.String(),
+			r.SaldoInicial.String(), r.SaldoFinal.String(), r.CreatedAt.UTC().Format(time.RFC3339), r.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return writeCSV(rows)
+}
+
+// itemsCSV: una fila por ingreso (incomes=true) o gasto, con el reporte al que pertenece.
+func itemsCSV(reports []models.Report, incomes bool) ([]byte, error) {
+	rows := [][]string{{"report_id", "month", "year", "id", "categoria_id", "concepto", "monto", "fecha"}}
+	add := func(r models.Report, id primitive.ObjectID, categoriaID *primitive.ObjectID, concepto string, monto models.Money, fecha string) {
+		categoria := ""
+		if categoriaID != nil {
+			categoria = categoriaID.Hex()
+		}
+		rows = append(rows, []string{r.ID.Hex(), r.Month, strconv.Itoa(r.Year), id.Hex(), categoria, concepto, monto.String(), fecha})
+	}
+	for _, r := range reports {
+		if incomes {
+			for _, item := range r.Ingresos {
+				add(r, item.ID, item.CategoriaID, item.Concepto, item.Monto, item.Fecha)
+			}
+		} else {
+			for _, item := range r.Gastos {
+				add(r, item.ID, item.CategoriaID, item.Concepto, item.Monto, item.Fecha)
+			}
+		}
+	}
+	return writeCSV(rows)
+}
+
+func auditCSV(events []models.AuditEvent) ([]byte, error) {
+	rows := [][]string{{"id", "type", "ip", "user_agent", "details", "created_at"}}
+	for _, e := range events {
+		details := ""
+		if len(e.Details) > 0 {
+			data, err := json.Marshal(e.Details)
+			if err != nil {
+				return nil, err
+			}
+			details = string(data)
+		}
+		rows = append(rows, []string{e.ID.Hex(), e.Type, e.IP, e.UserAgent, details, e.CreatedAt.UTC().Format(time.RFC3339)})
+	}
+	return writeCSV(rows)
+}
@@ -0,0 +1,371 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Estrategias para los meses del respaldo que ya existen en la cuenta
+const (
+	ImportConflictSkip      = "skip"
+	ImportConflictOverwrite = "overwrite"
+	// ImportConflictDuplicate se rechaza: el índice único (user_id, year, month) no permite dos
+	// reportes del mismo mes, así que no se puede importar una copia junto al existente.
+	ImportConflictDuplicate = "duplicate"
+)
+
+// Acción aplicada (o prevista, en dry-run) a cada reporte del respaldo
+const (
+	ImportActionCreated     = "created"
+	ImportActionOverwritten = "overwritten"
+	ImportActionSkipped     = "skipped"
+)
+
+// maxBackupEntrySize limita lo que se descomprime de cada fichero del zip.
+const maxBackupEntrySize = 64 << 20
+
+type ImportOptions struct {
+	DryRun   bool
+	Conflict string
+}
+
+type ImportedReport struct {
+	Month    string `json:"month"`
+	Year     int    `json:"year"`
+	Action   string `json:"action"`
+	ReportID string `json:"report_id,omitempty"`
+}
+
+type ImportResult struct {
+	DryRun        bool             `json:"dry_run"`
+	SchemaVersion int              `json:"schema_version"`
+	Conflict      string           `json:"conflict"`
+	Created       int              `json:"created"`
+	Overwritten   int              `json:"overwritten"`
+	Skipped       int              `json:"skipped"`
+	Reports       []ImportedReport `json:"reports"`
+}
+
+// ImportService restaura reportes desde un archivo generado por ExportService.
+type ImportService interface {
+	ImportBackup(ctx context.Context, userIDStr string, archive []byte, opts ImportOptions) (*ImportResult, error)
+}
+
+type importService struct {
+	userRepo     repositories.UserRepository
+	reportRepo   repositories.ReportRepository
+	categoryRepo repositories.CategoryRepository
+	client       *mongo.Client // Necesario para transacciones
+	audit        AuditService
+}
+
+func NewImportService(uRepo repositories.UserRepository, rRepo repositories.ReportRepository, cRepo repositories.CategoryRepository, client *mongo.Client, audit AuditService) ImportService {
+	return &importService{
+		userRepo:     uRepo,
+		reportRepo:   rRepo,
+		categoryRepo: cRepo,
+		client:       client,
+		audit:        audit,
+	}
+}
+
+// readBackup valida el manifest y devuelve los reportes del archivo.
+func readBackup(archive []byte) (*ExportManifest, []models.Report, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, nil, errors.New("archivo de respaldo inválido")
+	}
+	read := func(name string) ([]byte, error) {
+		f, err := zr.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("archivo de respaldo inválido: falta %s", name)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, maxBackupEntrySize+1))
+		if err != nil || len(data) > maxBackupEntrySize {
+			return nil, fmt.Errorf("archivo de respaldo inválido: %s", name)
+		}
+		return data, nil
+	}
+
+	data, err := read("manifest.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, errors.New("archivo de respaldo inválido: manifest.json")
+	}
+	if manifest.SchemaVersion < 1 || manifest.SchemaVersion > ExportSchemaVersion {
+		return nil, nil, fmt.Errorf("versión de esquema no soportada: %d", manifest.SchemaVersion)
+	}
+
+	data, err = read("reports.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	var reports []models.Report
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, nil, errors.New("archivo de respaldo inválido: reports.json")
+	}
+	upgradeBackup(manifest.SchemaVersion, reports)
+	for i, r := range reports {
+		period, err := models.ParsePeriod(r.Month, r.Year)
+		if err != nil {
+			return nil, nil, fmt.Errorf("archivo de respaldo inválido: reporte %d: %v", i+1, err)
+		}
+		reports[i].Month = period.MonthName()
+		if err := normalizeItemDates(reports[i].Ingresos, reports[i].Gastos, period); err != nil {
+			return nil, nil, fmt.Errorf("archivo de respaldo inválido: reporte %d: %v", i+1, err)
+		}
+	}
+	return &manifest, reports, nil
+}
+
+// upgradeBackup adapta los reportes de un archivo de una versión anterior (ver ExportSchemaVersion):
+// los campos que esa versión no tenía se vacían, para que un archivo editado a mano no los cuele.
+// Con eso basta, porque al importar los totales, las deducciones y los saldos se recalculan siempre
+// con la configuración actual y los reportes llegan abiertos.
+func upgradeBackup(version int, reports []models.Report) {
+	for i := range reports {
+		r := &reports[i]
+		if version < 2 {
+			for j := range r.Ingresos {
+				r.Ingresos[j].ItemDate = models.ItemDate{}
+			}
+			for j := range r.Gastos {
+				r.Gastos[j].ItemDate = models.ItemDate{}
+			}
+		}
+		if version < 3 {
+			r.Deducciones = nil
+			r.TotalDeducciones = 0
+		}
+		if version < 4 {
+			r.SaldoInicial = 0
+			r.SaldoFinal = 0
+		}
+		if version < 5 {
+			r.Cerrado = false
+			r.CerradoEn = nil
+			r.Cierres = nil
+		}
+	}
+}
+
+func periodKey(month string, year int) string {
+	return month + "/" + strconv.Itoa(year)
+}
+
+// ImportBackup recrea los reportes del respaldo en la cuenta, con IDs nuevos, en una sola transacción.
+// Con DryRun solo calcula qué se haría.
+func (s *importService) ImportBackup(ctx context.Context, userIDStr string, archive []byte, opts ImportOptions) (*ImportResult, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+	if opts.Conflict == "" {
+		opts.Conflict = ImportConflictSkip
+	}
+	if opts.Conflict == ImportConflictDuplicate {
+		return nil, errors.New("estrategia de conflicto inválida: duplicate no está disponible porque solo puede haber un reporte por mes y año (usa skip u overwrite)")
+	}
+	if opts.Conflict != ImportConflictSkip && opts.Conflict != ImportConflictOverwrite {
+		return nil, errors.New("estrategia de conflicto inválida (skip | overwrite)")
+	}
+
+	manifest, backup, err := readBackup(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+	existing, err := s.reportRepo.FindAll(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	byPeriod := make(map[string]models.Report, len(existing))
+	for _, r := range existing {
+		byPeriod[periodKey(r.Month, r.Year)] = r
+	}
+
+	// Las categorías son globales: si el respaldo viene de otra instalación, sus IDs no existen aquí
+	categories, err := s.categoryRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	knownCategories := make(map[primitive.ObjectID]bool, len(categories))
+	for _, c := range categories {
+		knownCategories[c.ID] = true
+	}
+	remapCategory := func(id *primitive.ObjectID) *primitive.ObjectID {
+		if id == nil || !knownCategories[*id] {
+			return nil
+		}
+		return id
+	}
+
+	result := &ImportResult{
+		DryRun:        opts.DryRun,
+		SchemaVersion: manifest.SchemaVersion,
+		Conflict:      opts.Conflict,
+		Reports:       []ImportedReport{},
+	}
+
+	type plannedWrite struct {
+		report    models.Report
+		overwrite bool
+		version   int64 // Versión leída del reporte que se sobrescribe
+	}
+	var writes []plannedWrite
+
+	now := time.Now()
+	for _, r := range backup {
+		// Remapeo: IDs nuevos para reporte e items, el usuario es el que importa
+		r.UserID = userID
+		r.Version = 0
+		// Los reportes importados llegan abiertos (se recalculan con la configuración actual)
+		r.Cerrado = false
+		r.CerradoEn = nil
+		r.Cierres = nil
+		for i := range r.Ingresos {
+			r.Ingresos[i].ID = primitive.NewObjectID()
+			r.Ingresos[i].CategoriaID = remapCategory(r.Ingresos[i].CategoriaID)
+		}
+		for i := range r.Gastos {
+			r.Gastos[i].ID = primitive.NewObjectID()
+			r.Gastos[i].CategoriaID = remapCategory(r.Gastos[i].CategoriaID)
+		}
+		if r.Ingresos == nil {
+			r.Ingresos = []models.Income{}
+		}
+		if r.Gastos == nil {
+			r.Gastos = []models.Expense{}
+		}
+		// Los totales se recalculan con la configuración actual del usuario
+		recalcReportTotals(&r, calcConfigFor(user))
+
+		key := periodKey(r.Month, r.Year)
+		current, conflict := byPeriod[key]
+		item := ImportedReport{Month: r.Month, Year: r.Year}
+		switch {
+		case !conflict:
+			r.ID = primitive.NewObjectID()
+			r.CreatedAt = now
+			r.UpdatedAt = now
+			item.Action = ImportActionCreated
+			result.Created++
+			writes = append(writes, plannedWrite{report: r})
+		case opts.Conflict == ImportConflictOverwrite && !current.Cerrado: // Un mes cerrado nunca se sobrescribe
+			r.ID = current.ID
+			r.CreatedAt = current.CreatedAt
+			item.Action = ImportActionOverwritten
+			result.Overwritten++
+			writes = append(writes, plannedWrite{report: r, overwrite: true, version: current.Version})
+		default:
+			r.ID = current.ID
+			item.Action = ImportActionSkipped
+			result.Skipped++
+		}
+		item.ReportID = r.ID.Hex()
+		result.Reports = append(result.Reports, item)
+		// Un mes repetido dentro del propio respaldo también cuenta como conflicto
+		byPeriod[key] = r
+	}
+
+	if opts.DryRun || len(writes) == 0 {
+		return result, nil
+	}
+
+	// Los saldos del respaldo pueden no cuadrar con los meses que ya había: se reencadenan desde el
+	// primer mes importado, en la misma transacción que las escrituras
+	from := periodIndex(&writes[0].report)
+	for _, w := range writes[1:] {
+		if p := periodIndex(&w.report); p < from {
+			from = p
+		}
+	}
+
+	// Iniciar Sesión para Transacción
+	session, err := s.client.StartSession()
+	if err != nil {
+		return nil, errors.New("error al iniciar sesión de DB")
+	}
+	defer session.EndSession(ctx)
+
+	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return err
+		}
+
+		for _, w := range writes {
+			var err error
+			if w.overwrite {
+				// Solo si sigue abierto y como se leyó: si se cerró o editó entretanto, la importación se anula
+				var res *mongo.UpdateResult
+				res, err = s.reportRepo.UpdateOpenIfVersion(sessionContext, w.report.ID, userID, w.version, bson.M{"$set": bson.M{
+					"month":               w.report.Month,
+					"year":                w.report.Year,
+					"ingresos":            w.report.Ingresos,
+					"gastos":              w.report.Gastos,
+					"porcentaje_ofrenda":  w.report.PorcentajeOfrenda,
+					"total_ingreso_bruto": w.report.TotalIngresoBruto,
+					"diezmos":             w.report.Diezmos,
+					"ofrendas":            w.report.Ofrendas,
+					"iglesia":             w.report.Iglesia,
+					"contribuciones":      w.report.Contribuciones,
+					"deducciones":         w.report.Deducciones,
+					"total_deducciones":   w.report.TotalDeducciones,
+					"ingresos_netos":      w.report.IngresosNetos,
+					"total_gastos":        w.report.TotalGastos,
+					"liquidacion":         w.report.Liquidacion,
+					"saldo_inicial":       w.report.SaldoInicial,
+					"saldo_final":         w.report.SaldoFinal,
+					"updated_at":          now,
+				}})
+				if err == nil && res.MatchedCount == 0 {
+					err = errConcurrentUpdate
+				}
+			} else {
+				_, err = s.reportRepo.Create(sessionContext, w.report)
+			}
+			if err != nil {
+				session.AbortTransaction(sessionContext)
+				return err
+			}
+		}
+		if _, err := refreshBalances(sessionContext, s.reportRepo, userID, user.EnableCarryOver, from); err != nil {
+			session.AbortTransaction(sessionContext)
+			return err
+		}
+
+		return session.CommitTransaction(sessionContext)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, userID, models.AuditDataImported, map[string]interface{}{
+		"conflict":    opts.Conflict,
+		"created":     result.Created,
+		"overwritten": result.Overwritten,
+		"skipped":     result.Skipped,
+	})
+	return result, nil
+}
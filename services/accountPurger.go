@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunAccountPurger borra periódicamente las cuentas cuyo plazo de restauración terminó y las
+// exportaciones caducadas. Se lanza en una goroutine al arrancar; con varias instancias el
+// borrado es idempotente.
+func RunAccountPurger(ctx context.Context, users UserService, exports ExportService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		purged, err := users.PurgeDeletedUsers(runCtx)
+		if err != nil {
+			log.Printf("error al purgar cuentas eliminadas: %v", err)
+		} else if purged > 0 {
+			log.Printf("cuentas eliminadas definitivamente: %d", purged)
+		}
+		expired, err := exports.CleanupExpired(runCtx)
+		if err != nil {
+			log.Printf("error al borrar exportaciones caducadas: %v", err)
+		} else if expired > 0 {
+			log.Printf("exportaciones caducadas borradas: %d", expired)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultAdminPageSize = 20
+	maxAdminPageSize     = 100
+)
+
+// PasswordResetEnforcer fuerza el restablecimiento de contraseña (lo implementa AuthService).
+type PasswordResetEnforcer interface {
+	RequirePasswordReset(ctx context.Context, user *models.User) error
+}
+
+// AdminService agrupa las operaciones de la API de administración (/api/admin).
+type AdminService interface {
+	ListUsers(ctx context.Context, query string, page, limit int) (*UserListPage, error)
+	GetUser(ctx context.Context, userIDStr string) (*models.User, error)
+	SetUserDisabled(ctx context.Context, adminIDStr, userIDStr string, disabled bool) error
+	ForcePasswordReset(ctx context.Context, adminIDStr, userIDStr string) error
+	SetUserRoles(ctx context.Context, adminIDStr, userIDStr string, roles []string) error
+	GetStats(ctx context.Context) (*SystemStats, error)
+	ListDuplicateReports(ctx context.Context) ([]models.PeriodDuplicate, error)
+	BootstrapAdmins(ctx context.Context)
+}
+
+// UserListPage es una página del listado de usuarios.
+type UserListPage struct {
+	Users []models.User `json:"users"`
+	Page  int           `json:"page"`
+	Limit int           `json:"limit"`
+	Total int64         `json:"total"`
+}
+
+// SystemStats son los contadores generales del sistema.
+type SystemStats struct {
+	Users          int64 `json:"users"`
+	VerifiedUsers  int64 `json:"verified_users"`
+	DisabledUsers  int64 `json:"disabled_users"`
+	TwoFactorUsers int64 `json:"two_factor_users"`
+	Admins         int64 `json:"admins"`
+	Reports        int64 `json:"reports"`
+	ActiveSessions int64 `json:"active_sessions"`
+}
+
+type SetRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type adminService struct {
+	userRepo   repositories.UserRepository
+	reportRepo repositories.ReportRepository
+	sessions   repositories.SessionRepository
+	resets     PasswordResetEnforcer
+	audit      AuditService
+}
+
+func NewAdminService(uRepo repositories.UserRepository, rRepo repositories.ReportRepository, sessions repositories.SessionRepository, resets PasswordResetEnforcer, audit AuditService) AdminService {
+	return &adminService{
+		userRepo:   uRepo,
+		reportRepo: rRepo,
+		sessions:   sessions,
+		resets:     resets,
+		audit:      audit,
+	}
+}
+
+// adminEmails devuelve los emails de ADMIN_EMAILS (separados por coma) en minúsculas.
+func adminEmails() []string {
+	var emails []string
+	for _, e := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			emails = append(emails, e)
+		}
+	}
+	return emails
+}
+
+// isBootstrapAdminEmail indica si el email está en ADMIN_EMAILS.
+func isBootstrapAdminEmail(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, e := range adminEmails() {
+		if e == email {
+			return true
+		}
+	}
+	return false
+}
+
+// BootstrapAdmins da el rol admin a las cuentas de ADMIN_EMAILS que ya tienen el email verificado.
+// Las que se verifiquen después lo reciben en VerifyEmail.
+func (s *adminService) BootstrapAdmins(ctx context.Context) {
+	for _, email := range adminEmails() {
+		res, err := s.userRepo.AddRoleByEmail(ctx, email, models.RoleAdmin)
+		if err != nil {
+			log.Printf("no se pudo asignar el rol admin a %s: %v", email, err)
+			continue
+		}
+		if res.MatchedCount == 0 {
+			log.Printf("ADMIN_EMAILS: %s no tiene una cuenta con el email verificado todavía", email)
+		}
+	}
+}
+
+func (s *adminService) ListUsers(ctx context.Context, query string, page, limit int) (*UserListPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultAdminPageSize
+	}
+	if limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+
+	filter := bson.M{}
+	if query = strings.TrimSpace(query); query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+		filter["$or"] = []bson.M{
+			{"email": pattern},
+			{"username": pattern},
+			{"fullname": pattern},
+		}
+	}
+
+	total, err := s.userRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.userRepo.Search(ctx, filter, int64((page-1)*limit), int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		users[i].Password = ""
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	return &UserListPage{Users: users, Page: page, Limit: limit, Total: total}, nil
+}
+
+func (s *adminService) GetUser(ctx context.Context, userIDStr string) (*models.User, error) {
+	oid, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+	user, err := s.userRepo.FindByID(ctx, oid)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// SetUserDisabled deshabilita (cerrando todas sus sesiones) o rehabilita una cuenta.
+func (s *adminService) SetUserDisabled(ctx context.Context, adminIDStr, userIDStr string, disabled bool) error {
+	if adminIDStr == userIDStr && disabled {
+		return errors.New("no puedes deshabilitar tu propia cuenta")
+	}
+	user, err := s.GetUser(ctx, userIDStr)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"disabled": true, "updated_at": time.Now()}}
+	event := models.AuditAccountDisabled
+	if !disabled {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"disabled": ""}}
+		event = models.AuditAccountEnabled
+	}
+	if _, err := s.userRepo.Update(ctx, user.ID, update); err != nil {
+		return err
+	}
+	if disabled {
+		if _, err := s.sessions.RevokeAllByUser(ctx, user.ID, primitive.NilObjectID); err != nil {
+			return err
+		}
+	}
+	s.audit.Record(ctx, user.ID, event, map[string]interface{}{"by": adminIDStr})
+	return nil
+}
+
+// ForcePasswordReset obliga al usuario a elegir una contraseña nueva antes de volver a entrar.
+func (s *adminService) ForcePasswordReset(ctx context.Context, adminIDStr, userIDStr string) error {
+	user, err := s.GetUser(ctx, userIDStr)
+	if err != nil {
+		return err
+	}
+	if err := s.resets.RequirePasswordReset(ctx, user); err != nil {
+		if !errors.Is(err, errMailNotSent) {
+			return err
+		}
+		// La cuenta ya quedó bloqueada; el usuario puede pedir otro enlace con forgot-password
+		log.Printf("no se pudo enviar el correo de recuperación a %s: %v", user.Email, err)
+	}
+	s.audit.Record(ctx, user.ID, models.AuditPasswordResetForce, map[string]interface{}{"by": adminIDStr})
+	return nil
+}
+
+// SetUserRoles reemplaza los roles del usuario. Un administrador no puede quitarse a sí mismo el rol admin.
+func (s *adminService) SetUserRoles(ctx context.Context, adminIDStr, userIDStr string, roles []string) error {
+	clean := []string{}
+	for _, role := range roles {
+		valid := false
+		for _, r := range models.ValidRoles {
+			if role == r {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.New("rol inválido: " + role)
+		}
+		dup := false
+		for _, r := range clean {
+			if r == role {
+				dup = true
+			}
+		}
+		if !dup {
+			clean = append(clean, role)
+		}
+	}
+
+	user, err := s.GetUser(ctx, userIDStr)
+	if err != nil {
+		return err
+	}
+	updated := models.User{Roles: clean}
+	if adminIDStr == userIDStr && !updated.HasRole(models.RoleAdmin) {
+		return errors.New("no puedes quitarte el rol de administrador")
+	}
+
+	_, err = s.userRepo.Update(ctx, user.ID, bson.M{"$set": bson.M{"roles": clean, "updated_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user.ID, models.AuditRolesChanged, map[string]interface{}{"by": adminIDStr, "from": user.Roles, "to": clean})
+	return nil
+}
+
+func (s *adminService) GetStats(ctx context.Context) (*SystemStats, error) {
+	var stats SystemStats
+	counts := []struct {
+		dst    *int64
+		filter bson.M
+	}{
+		{&stats.Users, bson.M{}},
+		{&stats.VerifiedUsers, bson.M{"email_verified": true}},
+		{&stats.DisabledUsers, bson.M{"disabled": true}},
+		{&stats.TwoFactorUsers, bson.M{"two_factor_enabled": true}},
+		{&stats.Admins, bson.M{"roles": models.RoleAdmin}},
+	}
+	for _, c := range counts {
+		n, err := s.userRepo.Count(ctx, c.filter)
+		if err != nil {
+			return nil, err
+		}
+		*c.dst = n
+	}
+
+	var err error
+	if stats.Reports, err = s.reportRepo.CountAll(ctx); err != nil {
+		return nil, err
+	}
+	if stats.ActiveSessions, err = s.sessions.CountActive(ctx); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// ListDuplicateReports devuelve los periodos con varios reportes del mismo usuario, anteriores al índice único.
+func (s *adminService) ListDuplicateReports(ctx context.Context) ([]models.PeriodDuplicate, error) {
+	return s.reportRepo.FindDuplicatePeriods(ctx)
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultAuditPageSize = 20
+	maxAuditPageSize     = 100
+)
+
+// AuditService registra y lista los eventos de seguridad de cada cuenta.
+type AuditService interface {
+	// Record guarda un evento con la IP y el User-Agent del contexto. Un fallo solo se registra en el log:
+	// la auditoría no debe impedir la operación que se audita.
+	Record(ctx context.Context, userID primitive.ObjectID, eventType string, details map[string]interface{})
+	ListForUser(ctx context.Context, userIDStr string, page, limit int) (*AuditLogPage, error)
+}
+
+// AuditLogPage es una página del registro de auditoría.
+type AuditLogPage struct {
+	Events []models.AuditEvent `json:"events"`
+	Page   int                 `json:"page"`
+	Limit  int                 `json:"limit"`
+	Total  int64               `json:"total"`
+}
+
+type auditService struct {
+	repo repositories.AuditRepository
+}
+
+func NewAuditService(repo repositories.AuditRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+func (s *auditService) Record(ctx context.Context, userID primitive.ObjectID, eventType string, details map[string]interface{}) {
+	meta := requestMetaFrom(ctx)
+	event := models.AuditEvent{
+		UserID:    userID,
+		Type:      eventType,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.repo.Insert(ctx, event); err != nil {
+		log.Printf("no se pudo registrar el evento de auditoría %s de %s: %v", eventType, userID.Hex(), err)
+	}
+}
+
+func (s *auditService) ListForUser(ctx context.Context, userIDStr string, page, limit int) (*AuditLogPage, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	total, err := s.repo.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.repo.FindByUser(ctx, userID, int64((page-1)*limit), int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []models.AuditEvent{}
+	}
+	return &AuditLogPage{Events: events, Page: page, Limit: limit, Total: total}, nil
+}
@@ -2,19 +2,66 @@ package services
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
-	"os"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/JimcostDev/finances-api/mailer"
 	"github.com/JimcostDev/finances-api/models"
 	"github.com/JimcostDev/finances-api/repositories"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthService interface {
 	RegisterUser(ctx context.Context, req RegisterRequest) (*models.User, error)
-	LoginUser(ctx context.Context, req LoginRequest) (string, error)
+	// LoginUser devuelve los tokens o, si el usuario tiene 2FA, un token "mfa pending".
+	LoginUser(ctx context.Context, req LoginRequest) (*LoginResult, error)
+	CompleteMFALogin(ctx context.Context, req MFALoginRequest) (*AuthTokens, error)
+	// MFATokenUserID devuelve el usuario de un token "mfa pending" ("" si no es válido).
+	MFATokenUserID(mfaToken string) string
+	// RefreshSession rota el refresh token y emite un nuevo access token para la misma sesión.
+	// csrfToken es la cabecera X-CSRF-Token: el refresh token llega por cookie y debe coincidir con el de la sesión.
+	RefreshSession(ctx context.Context, refreshToken, csrfToken string) (*AuthTokens, error)
+	// Logout revoca la sesión del refresh token (o, si no hay, la del access token).
+	Logout(ctx context.Context, req LogoutRequest) error
+	// Authenticate valida el access token y que su sesión siga activa.
+	Authenticate(ctx context.Context, accessToken string) (*Principal, error)
+
+	// Sesiones activas / dispositivos
+	ListSessions(ctx context.Context, userIDStr string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userIDStr, sessionIDStr string) error
+	RevokeOtherSessions(ctx context.Context, userIDStr, currentSessionIDStr string) (int64, error)
+
+	// Recuperación de contraseña
+	ForgotPassword(ctx context.Context, req ForgotPasswordRequest) error
+	ResetPassword(ctx context.Context, req ResetPasswordRequest) error
+
+	// Verificación de email
+	RequestEmailVerification(ctx context.Context, user *models.User, email string) error
+	VerifyEmail(ctx context.Context, req VerifyEmailRequest) error
+	ResendVerification(ctx context.Context, req ResendVerificationRequest) error
+
+	// Verificación en dos pasos (TOTP)
+	SetupTwoFactor(ctx context.Context, userIDStr string) (*TwoFactorSetup, error)
+	EnableTwoFactor(ctx context.Context, userIDStr string, req TwoFactorCodeRequest) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userIDStr string, req DisableTwoFactorRequest) error
+	RegenerateRecoveryCodes(ctx context.Context, userIDStr string, req TwoFactorCodeRequest) ([]string, error)
+
+	// Tokens personales para scripts e integraciones
+	CreatePersonalToken(ctx context.Context, userIDStr string, req CreatePersonalTokenRequest) (*CreatedPersonalToken, error)
+	ListPersonalTokens(ctx context.Context, userIDStr string) ([]models.PersonalAccessToken, error)
+	DeletePersonalToken(ctx context.Context, userIDStr, tokenIDStr string) error
+
+	// Administración y restauración de cuentas
+	RequirePasswordReset(ctx context.Context, user *models.User) error
+	VerifyCredentials(ctx context.Context, email, password, code, recoveryCode string) (*models.User, error)
+
+	// JWKS publica las claves públicas de verificación
+	JWKS() map[string]interface{}
 }
 
 // Estructuras de Request (Movidas aquí para ser accesibles)
@@ -31,19 +78,73 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// LogoutRequest son las credenciales con las que se identifica la sesión a cerrar.
+type LogoutRequest struct {
+	RefreshToken    string // cookie
+	AccessToken     string
+	AccessViaCookie bool   // el access token llegó por cookie (exige CSRF) y no por Authorization: Bearer
+	CSRFToken       string // cabecera X-CSRF-Token
+}
+
+// errInvalidCSRF: petición autenticada por cookie sin el token anti-CSRF de la sesión.
+var errInvalidCSRF = errors.New("token CSRF inválido o ausente")
+
+// validCSRF compara en tiempo constante el token enviado con el de la sesión.
+func validCSRF(expected, sent string) bool {
+	return expected != "" && sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1
+}
+
+// AuthTokens es el par de tokens emitido al iniciar o renovar sesión.
+type AuthTokens struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	CSRFToken        string // se devuelve al cliente (no es cookie) y debe reenviarse en X-CSRF-Token
+}
+
+// LoginResult: Tokens si la sesión quedó iniciada; MFAToken si falta el segundo factor.
+type LoginResult struct {
+	Tokens   *AuthTokens
+	MFAToken string
+}
+
+// Principal identifica al usuario autenticado de una petición.
+type Principal struct {
+	UserID     string
+	SessionID  string // vacío para tokens personales
+	AuthMethod string // AuthMethodSession | AuthMethodPersonalToken
+	Scope      string // models.TokenScope*; las sesiones tienen read_write
+	CSRFToken  string // token anti-CSRF de la sesión; vacío para tokens personales
+	Roles      []string
+}
+
 type authService struct {
-	repo repositories.UserRepository
+	repo           repositories.UserRepository
+	sessions       repositories.SessionRepository
+	userTokens     repositories.UserTokenRepository
+	personalTokens repositories.PersonalTokenRepository
+	mailer         mailer.Mailer
+	keys           *JWTKeySet
+	audit          AuditService
 }
 
-func NewAuthService(repo repositories.UserRepository) AuthService {
-	return &authService{repo: repo}
+func NewAuthService(repo repositories.UserRepository, sessions repositories.SessionRepository, userTokens repositories.UserTokenRepository, personalTokens repositories.PersonalTokenRepository, m mailer.Mailer, keys *JWTKeySet, audit AuditService) AuthService {
+	return &authService{repo: repo, sessions: sessions, userTokens: userTokens, personalTokens: personalTokens, mailer: m, keys: keys, audit: audit}
 }
 
 func (s *authService) RegisterUser(ctx context.Context, req RegisterRequest) (*models.User, error) {
-	// 1. Validar contraseñas
+	// 1. Validar email y contraseñas
+	req.Email = strings.TrimSpace(req.Email)
+	if err := validateEmail(req.Email); err != nil {
+		return nil, err
+	}
 	if req.Password != req.ConfirmPassword {
 		return nil, errors.New("las contraseñas no coinciden")
 	}
+	if err := validatePassword(req.Password, req.Email, req.Username); err != nil {
+		return nil, err
+	}
 
 	// 2. Validar existencia
 	exists, err := s.repo.ExistsByEmailOrUsername(ctx, req.Email, req.Username)
@@ -55,61 +156,344 @@ func (s *authService) RegisterUser(ctx context.Context, req RegisterRequest) (*m
 	}
 
 	// 3. Hashear password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
-		return nil, errors.New("error al encriptar la contraseña")
+		return nil, err
 	}
 
 	// 4. Crear modelo
 	user := models.User{
 		Email:                     req.Email,
+		EmailVerified:             false,
 		Username:                  req.Username,
 		Fullname:                  req.Fullname,
-		Password:                  string(hashedPassword),
+		Password:                  hashedPassword,
 		EnableChurchContributions: false,
 		CreatedAt:                 time.Now(),
 		UpdatedAt:                 time.Now(),
 	}
 
 	// 5. Guardar en DB
-	_, err = s.repo.Create(ctx, user)
+	res, err := s.repo.Create(ctx, user)
 	if err != nil {
 		return nil, err
 	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+
+	// 6. Enviar verificación (un fallo del correo no impide el registro: se puede reenviar)
+	if err := s.RequestEmailVerification(ctx, &user, user.Email); err != nil {
+		log.Printf("no se pudo enviar el correo de verificación a %s: %v", user.Email, err)
+	}
 
 	// Limpiar password antes de devolver
 	user.Password = ""
 	return &user, nil
 }
 
-func (s *authService) LoginUser(ctx context.Context, req LoginRequest) (string, error) {
+func (s *authService) LoginUser(ctx context.Context, req LoginRequest) (*LoginResult, error) {
 	// 1. Buscar usuario
 	user, err := s.repo.FindByEmail(ctx, req.Email)
 	if err != nil {
-		return "", errors.New("credenciales inválidas")
+		return nil, errors.New("credenciales inválidas")
+	}
+
+	// 2. Comparar hash (bcrypt o argon2id)
+	ok, needsRehash := verifyPassword(user.Password, req.Password)
+	if !ok {
+		s.audit.Record(ctx, user.ID, models.AuditLoginFailed, map[string]interface{}{"reason": "password"})
+		return nil, errors.New("credenciales inválidas")
+	}
+	// Hashes antiguos (bcrypt o parámetros anteriores) se regeneran ahora que tenemos la contraseña en claro
+	if needsRehash {
+		s.upgradePasswordHash(ctx, user, req.Password)
+	}
+
+	if err := checkAccountActive(user); err != nil {
+		return nil, err
+	}
+	if emailVerificationRequired() && !user.EmailVerified {
+		return nil, errors.New("email no verificado")
+	}
+
+	// 3. Con 2FA la sesión no se crea hasta validar el código (POST /api/auth/login/2fa)
+	if user.TwoFactorEnabled {
+		mfaToken, err := s.signMFAToken(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
+	}
+
+	// 4. Crear sesión persistida y emitir tokens
+	tokens, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, user.ID, models.AuditLoginSucceeded, map[string]interface{}{"method": "password"})
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// startSession crea la sesión en BD y emite access + refresh token.
+func (s *authService) startSession(ctx context.Context, user *models.User) (*AuthTokens, error) {
+	now := time.Now()
+	meta := requestMetaFrom(ctx)
+	session := models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID,
+		UserAgent:  meta.UserAgent,
+		IP:         meta.IP,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(refreshTokenTTL()),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	refreshToken, refreshHash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, errors.New("no se pudo generar el token")
+	}
+	session.RefreshTokenHash = refreshHash
+	if session.CSRFToken, err = generateOpaqueToken(); err != nil {
+		return nil, errors.New("no se pudo generar el token")
+	}
+
+	if _, err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, &session, refreshToken)
+}
+
+// issueTokens firma el access token ("id" como hex string para claims en el middleware; "sid" = sesión).
+func (s *authService) issueTokens(user *models.User, session *models.Session, refreshToken string) (*AuthTokens, error) {
+	accessExpiresAt := time.Now().Add(accessTokenTTL())
+	accessToken, err := s.keys.sign(jwt.MapClaims{
+		"id":    user.ID.Hex(),
+		"email": user.Email,
+		"sid":   session.ID.Hex(),
+		"typ":   "access",
+		"iat":   time.Now().Unix(),
+		"exp":   accessExpiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+		CSRFToken:        session.CSRFToken,
+	}, nil
+}
+
+func (s *authService) RefreshSession(ctx context.Context, refreshToken, csrfToken string) (*AuthTokens, error) {
+	sessionID, secret, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessions.FindByID(ctx, sessionID)
+	if err != nil || !session.IsActive(time.Now()) {
+		return nil, errors.New("sesión inválida o expirada")
+	}
+	currentHash := hashToken(secret)
+	if subtle.ConstantTimeCompare([]byte(currentHash), []byte(session.RefreshTokenHash)) != 1 {
+		return nil, errors.New("sesión inválida o expirada")
+	}
+
+	user, err := s.repo.FindByID(ctx, session.UserID)
+	if err != nil || checkAccountActive(user) != nil {
+		return nil, errors.New("sesión inválida o expirada")
+	}
+	// El refresh token viaja en cookie: sin el token anti-CSRF un sitio ajeno podría rotar la sesión
+	if !validCSRF(session.CSRFToken, csrfToken) {
+		return nil, errInvalidCSRF
+	}
+
+	// Rotación: el refresh token anterior deja de ser válido
+	newToken, newHash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, errors.New("no se pudo generar el token")
+	}
+	session.ExpiresAt = time.Now().Add(refreshTokenTTL())
+	res, err := s.sessions.RotateRefreshToken(ctx, session.ID, currentHash, newHash, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("sesión inválida o expirada")
+	}
+
+	return s.issueTokens(user, session, newToken)
+}
+
+func (s *authService) Logout(ctx context.Context, req LogoutRequest) error {
+	if req.RefreshToken != "" {
+		sessionID, secret, err := parseRefreshToken(req.RefreshToken)
+		if err == nil {
+			session, err := s.sessions.FindByID(ctx, sessionID)
+			if err == nil && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(session.RefreshTokenHash)) == 1 {
+				if !validCSRF(session.CSRFToken, req.CSRFToken) {
+					return errInvalidCSRF
+				}
+				if _, err = s.sessions.Revoke(ctx, session.ID, session.UserID); err != nil {
+					return err
+				}
+				s.audit.Record(ctx, session.UserID, models.AuditLogout, map[string]interface{}{"session_id": session.ID.Hex()})
+				return nil
+			}
+		}
+	}
+
+	if req.AccessToken != "" {
+		principal, err := s.Authenticate(ctx, req.AccessToken)
+		if err == nil && principal.AuthMethod == AuthMethodSession {
+			if req.AccessViaCookie && !validCSRF(principal.CSRFToken, req.CSRFToken) {
+				return errInvalidCSRF
+			}
+			userID, sessionID := principal.UserID, principal.SessionID
+			if err := s.revokeSession(ctx, userID, sessionID); err != nil {
+				return err
+			}
+			if oid, err := primitive.ObjectIDFromHex(userID); err == nil {
+				s.audit.Record(ctx, oid, models.AuditLogout, map[string]interface{}{"session_id": sessionID})
+			}
+			return nil
+		}
+	}
+
+	// Sin sesión identificable: no hay nada que revocar (el handler igualmente borra las cookies)
+	return nil
+}
+
+func (s *authService) JWKS() map[string]interface{} {
+	return s.keys.JWKS()
+}
+
+func (s *authService) Authenticate(ctx context.Context, accessToken string) (*Principal, error) {
+	if strings.HasPrefix(accessToken, personalTokenPrefix) {
+		return s.authenticatePersonalToken(ctx, accessToken)
+	}
+
+	claims, err := s.keys.parse(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != "access" {
+		return nil, errors.New("token inválido")
+	}
+	userID, ok := claims["id"].(string)
+	if !ok {
+		return nil, errors.New("ID de usuario no válido en el token")
+	}
+	// Tokens sin "sid" (emitidos antes de las sesiones persistidas) ya no se aceptan
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		return nil, errors.New("token inválido")
+	}
+	sessionID, err := primitive.ObjectIDFromHex(sid)
+	if err != nil {
+		return nil, errors.New("token inválido")
 	}
 
-	// 2. Comparar hash
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return "", errors.New("credenciales inválidas")
+	now := time.Now()
+	session, err := s.sessions.FindByID(ctx, sessionID)
+	if err != nil || !session.IsActive(now) || session.UserID.Hex() != userID {
+		return nil, errors.New("sesión revocada o expirada")
+	}
+	user, err := s.repo.FindByID(ctx, session.UserID)
+	if err != nil || user.Disabled {
+		return nil, errors.New("cuenta deshabilitada")
 	}
 
-	// 3. Generar JWT (30 días; "id" como hex string para claims en el middleware)
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["id"] = user.ID.Hex()
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(30 * 24 * time.Hour).Unix()
+	// "Última actividad" con resolución de un minuto para no escribir en cada petición
+	if now.Sub(session.LastSeenAt) > time.Minute {
+		_, _ = s.sessions.Touch(ctx, session.ID, now)
+	}
+	if err := s.ensureCSRFToken(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		UserID:     userID,
+		SessionID:  sid,
+		AuthMethod: AuthMethodSession,
+		Scope:      models.TokenScopeReadWrite,
+		CSRFToken:  session.CSRFToken,
+		Roles:      user.Roles,
+	}, nil
+}
+
+// upgradePasswordHash regenera el hash con el algoritmo actual. Un fallo no impide el login.
+func (s *authService) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	hashed, err := hashPassword(password)
+	if err == nil {
+		_, err = s.repo.Update(ctx, user.ID, bson.M{"$set": bson.M{"password": hashed}})
+	}
+	if err != nil {
+		log.Printf("no se pudo actualizar el hash de la contraseña de %s: %v", user.ID.Hex(), err)
+	}
+}
 
-	secretKey := os.Getenv("JWT_SECRET_KEY")
-	if secretKey == "" {
-		return "", errors.New("JWT_SECRET_KEY no está definida")
+// checkAccountActive rechaza cuentas deshabilitadas o con restablecimiento de contraseña forzado.
+func checkAccountActive(user *models.User) error {
+	if user.Disabled {
+		return errors.New("cuenta deshabilitada")
+	}
+	if user.PasswordResetRequired {
+		return errors.New("debes restablecer tu contraseña")
 	}
+	if user.DeletionScheduledAt != nil {
+		return errors.New("cuenta pendiente de eliminación")
+	}
+	return nil
+}
 
-	t, err := token.SignedString([]byte(secretKey))
+// VerifyCredentials comprueba email, contraseña y, si está activa, la verificación en dos pasos,
+// sin crear sesión ni mirar el estado de la cuenta (lo usa la restauración de cuentas pendientes de eliminación).
+func (s *authService) VerifyCredentials(ctx context.Context, email, password, code, recoveryCode string) (*models.User, error) {
+	user, err := s.repo.FindByEmail(ctx, strings.TrimSpace(email))
 	if err != nil {
-		return "", errors.New("no se pudo generar el token")
+		return nil, errors.New("credenciales inválidas")
 	}
+	if ok, _ := verifyPassword(user.Password, password); !ok {
+		s.audit.Record(ctx, user.ID, models.AuditLoginFailed, map[string]interface{}{"reason": "password"})
+		return nil, errors.New("credenciales inválidas")
+	}
+	if user.TwoFactorEnabled {
+		if err := s.verifySecondFactor(ctx, user, code, recoveryCode); err != nil {
+			s.audit.Record(ctx, user.ID, models.AuditLoginFailed, map[string]interface{}{"reason": "second_factor"})
+			return nil, err
+		}
+	}
+	return user, nil
+}
 
-	return t, nil
+// ensureCSRFToken asigna un token anti-CSRF a las sesiones creadas antes de que existiera.
+// Si otra petición lo asignó a la vez, se usa el que quedó guardado.
+func (s *authService) ensureCSRFToken(ctx context.Context, session *models.Session) error {
+	if session.CSRFToken != "" {
+		return nil
+	}
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return errors.New("no se pudo generar el token")
+	}
+	res, err := s.sessions.SetCSRFToken(ctx, session.ID, token)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 1 {
+		session.CSRFToken = token
+		return nil
+	}
+	stored, err := s.sessions.FindByID(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	session.CSRFToken = stored.CSRFToken
+	return nil
 }
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListSessions devuelve las sesiones activas (dispositivos) del usuario.
+func (s *authService) ListSessions(ctx context.Context, userIDStr string) ([]models.Session, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+	sessions, err := s.sessions.FindActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	return sessions, nil
+}
+
+// RevokeSession cierra una sesión concreta del usuario (p. ej. un portátil compartido).
+func (s *authService) RevokeSession(ctx context.Context, userIDStr, sessionIDStr string) error {
+	if err := s.revokeSession(ctx, userIDStr, sessionIDStr); err != nil {
+		return err
+	}
+	userID, _ := primitive.ObjectIDFromHex(userIDStr)
+	s.audit.Record(ctx, userID, models.AuditSessionRevoked, map[string]interface{}{"session_id": sessionIDStr})
+	return nil
+}
+
+// revokeSession revoca la sesión sin registrar el evento (Logout registra el suyo propio).
+func (s *authService) revokeSession(ctx context.Context, userIDStr, sessionIDStr string) error {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return errors.New("ID inválido")
+	}
+	sessionID, err := primitive.ObjectIDFromHex(sessionIDStr)
+	if err != nil {
+		return errors.New("sesión no encontrada")
+	}
+
+	res, err := s.sessions.Revoke(ctx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("sesión no encontrada")
+	}
+	return nil
+}
+
+// RevokeOtherSessions cierra todas las sesiones del usuario excepto la actual ("cerrar sesión en los demás dispositivos").
+func (s *authService) RevokeOtherSessions(ctx context.Context, userIDStr, currentSessionIDStr string) (int64, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return 0, errors.New("ID inválido")
+	}
+	currentID, err := primitive.ObjectIDFromHex(currentSessionIDStr)
+	if err != nil {
+		return 0, errors.New("sesión no encontrada")
+	}
+
+	res, err := s.sessions.RevokeAllByUser(ctx, userID, currentID)
+	if err != nil {
+		return 0, err
+	}
+	if res.ModifiedCount > 0 {
+		s.audit.Record(ctx, userID, models.AuditSessionRevoked, map[string]interface{}{"other_sessions": res.ModifiedCount})
+	}
+	return res.ModifiedCount, nil
+}
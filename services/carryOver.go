@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Balance es el saldo de apertura y de cierre de un reporte y su versión tras guardarlos.
+type Balance struct {
+	Inicial models.Money
+	Final   models.Money
+	Version int64
+}
+
+// allPeriods como periodo de partida recalcula la cadena completa.
+const allPeriods = 0
+
+// periodIndex ordena los reportes en el tiempo (meses desde el año 0).
+func periodIndex(r *models.Report) int {
+	p, err := reportPeriod(r)
+	if err != nil {
+		return r.Year * 12
+	}
+	return p.Year*12 + p.Month - 1
+}
+
+// sortByPeriod deja los reportes en orden cronológico.
+func sortByPeriod(reports []models.Report) {
+	sort.SliceStable(reports, func(i, j int) bool { return periodIndex(&reports[i]) < periodIndex(&reports[j]) })
+}
+
+// computeBalances recorre los reportes en orden cronológico. Con arrastre, el saldo inicial de cada
+// mes es el saldo final del reporte anterior que exista (los meses sin reporte no cortan la cadena);
+// sin arrastre es 0 y el saldo final coincide con la liquidación. Los reportes cerrados y los
+// anteriores al periodo from (periodIndex) no cambian: la cadena sigue desde su saldo final guardado.
+func computeBalances(reports []models.Report, carryOver bool, from int) map[primitive.ObjectID]Balance {
+	sorted := append([]models.Report(nil), reports...)
+	sortByPeriod(sorted)
+
+	balances := make(map[primitive.ObjectID]Balance, len(sorted))
+	var previous models.Money
+	for _, r := range sorted {
+		b := Balance{Inicial: r.SaldoInicial, Final: r.SaldoFinal, Version: r.Version}
+		if !r.Cerrado && periodIndex(&r) >= from {
+			b.Inicial = 0
+			if carryOver {
+				b.Inicial = previous
+			}
+			b.Final = b.Inicial + r.Liquidacion
+		}
+		balances[r.ID] = b
+		previous = b.Final
+	}
+	return balances
+}
+
+// RunningBalances devuelve, por reporte, la liquidación acumulada hasta ese mes (incluido).
+func RunningBalances(reports []models.Report) map[primitive.ObjectID]models.Money {
+	sorted := append([]models.Report(nil), reports...)
+	sortByPeriod(sorted)
+
+	running := make(map[primitive.ObjectID]models.Money, len(sorted))
+	var total models.Money
+	for _, r := range sorted {
+		total += r.Liquidacion
+		running[r.ID] = total
+	}
+	return running
+}
+
+// refreshBalances recalcula saldo_inicial y saldo_final de los reportes del usuario desde el periodo
+// from (periodIndex del mes modificado, o allPeriods) y guarda solo los que cambiaron: un mes cuyo saldo
+// no se mueve conserva su version y su ETag (sin 412 espurios para quien lo tenga abierto). Cada
+// escritura es un compare-and-swap que incrementa version; si otra escritura se adelanta, se vuelve a
+// leer y recalcular.
+func refreshBalances(ctx context.Context, repo repositories.ReportRepository, userID primitive.ObjectID, carryOver bool, from int) (map[primitive.ObjectID]Balance, error) {
+	for attempt := 0; attempt < maxMutationAttempts; attempt++ {
+		reports, err := repo.FindAll(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		balances := computeBalances(reports, carryOver, from)
+		conflict := false
+		for _, r := range reports {
+			b := balances[r.ID]
+			if r.SaldoInicial == b.Inicial && r.SaldoFinal == b.Final {
+				continue
+			}
+			update := bson.M{"$set": bson.M{"saldo_inicial": b.Inicial, "saldo_final": b.Final}}
+			res, err := repo.UpdateOpenIfVersion(ctx, r.ID, userID, r.Version, update)
+			if err != nil {
+				return nil, err
+			}
+			if res.MatchedCount == 0 {
+				conflict = true
+				break
+			}
+			b.Version = r.Version + 1
+			balances[r.ID] = b
+		}
+		if !conflict {
+			return balances, nil
+		}
+	}
+	return nil, errConcurrentUpdate
+}
+
+// propagateBalances se llama dentro de la transacción que escribe un reporte: con arrastre activo
+// actualiza los meses desde from y el propio report (saldos y version). Si falla, la transacción se
+// deshace entera y el error llega al cliente, así que nunca quedan meses posteriores con saldos viejos.
+func (s *reportService) propagateBalances(ctx context.Context, userObjID primitive.ObjectID, cfg calcConfig, from int, report *models.Report) error {
+	if !cfg.carryOver {
+		return nil
+	}
+	balances, err := refreshBalances(ctx, s.repo, userObjID, true, from)
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		if b, ok := balances[report.ID]; ok {
+			report.SaldoInicial = b.Inicial
+			report.SaldoFinal = b.Final
+			report.Version = b.Version
+		}
+	}
+	return nil
+}
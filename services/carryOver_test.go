@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// balanceRepo guarda los reportes en memoria; solo implementa lo que usa refreshBalances.
+type balanceRepo struct {
+	repositories.ReportRepository
+	reports []models.Report
+	writes  []primitive.ObjectID
+}
+
+func (r *balanceRepo) FindAll(ctx context.Context, userID primitive.ObjectID) ([]models.Report, error) {
+	return append([]models.Report(nil), r.reports...), nil
+}
+
+func (r *balanceRepo) UpdateOpenIfVersion(ctx context.Context, oid, userID primitive.ObjectID, version int64, update bson.M) (*mongo.UpdateResult, error) {
+	set := update["$set"].(bson.M)
+	for i := range r.reports {
+		rep := &r.reports[i]
+		if rep.ID != oid || rep.Version != version || rep.Cerrado {
+			continue
+		}
+		rep.SaldoInicial = set["saldo_inicial"].(models.Money)
+		rep.SaldoFinal = set["saldo_final"].(models.Money)
+		rep.Version++
+		r.writes = append(r.writes, oid)
+		return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+	}
+	return &mongo.UpdateResult{}, nil
+}
+
+// Solo se escriben (y cambian de versión) los meses cuyo saldo se mueve.
+func TestRefreshBalancesSkipsUnchanged(t *testing.T) {
+	enero := models.Report{ID: primitive.NewObjectID(), Month: "Enero", Year: 2026, Liquidacion: 100, SaldoFinal: 100, Version: 3}
+	febrero := models.Report{ID: primitive.NewObjectID(), Month: "Febrero", Year: 2026, Liquidacion: 50, SaldoInicial: 100, SaldoFinal: 150, Version: 7}
+	marzo := models.Report{ID: primitive.NewObjectID(), Month: "Marzo", Year: 2026, Liquidacion: 20, SaldoInicial: 0, SaldoFinal: 20, Version: 2}
+	repo := &balanceRepo{reports: []models.Report{marzo, enero, febrero}}
+
+	balances, err := refreshBalances(context.Background(), repo, primitive.NewObjectID(), true, allPeriods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.writes) != 1 || repo.writes[0] != marzo.ID {
+		t.Fatalf("escrituras %v, se esperaba solo marzo (%s)", repo.writes, marzo.ID.Hex())
+	}
+	if b := balances[enero.ID]; b.Version != 3 {
+		t.Errorf("enero version = %d, se esperaba 3 (sin cambios)", b.Version)
+	}
+	if b := balances[febrero.ID]; b.Version != 7 {
+		t.Errorf("febrero version = %d, se esperaba 7 (sin cambios)", b.Version)
+	}
+	if b := balances[marzo.ID]; b.Inicial != 150 || b.Final != 170 || b.Version != 3 {
+		t.Errorf("marzo = %+v, se esperaba saldo 150 → 170 en la versión 3", b)
+	}
+
+	// Una segunda pasada no escribe nada
+	repo.writes = nil
+	if _, err := refreshBalances(context.Background(), repo, primitive.NewObjectID(), true, allPeriods); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.writes) != 0 {
+		t.Errorf("la segunda pasada escribió %d reportes", len(repo.writes))
+	}
+}
@@ -2,13 +2,18 @@ package services
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/JimcostDev/finances-api/models"
 	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type CategoryService interface {
 	GetCategories(ctx context.Context) ([]models.Category, error)
+	CreateCategory(ctx context.Context, category models.Category) (*models.Category, error)
+	DeleteCategory(ctx context.Context, idStr string) error
 }
 
 type categoryService struct {
@@ -23,3 +28,42 @@ func (s *categoryService) GetCategories(ctx context.Context) ([]models.Category,
 	return s.repo.FindAll(ctx)
 }
 
+// CreateCategory añade una categoría global (solo administradores).
+func (s *categoryService) CreateCategory(ctx context.Context, category models.Category) (*models.Category, error) {
+	category.Nombre = strings.TrimSpace(category.Nombre)
+	if category.Nombre == "" {
+		return nil, errors.New("el nombre de la categoría es obligatorio")
+	}
+	if category.Tipo != "ingreso" && category.Tipo != "gasto" {
+		return nil, errors.New("tipo inválido (ingreso | gasto)")
+	}
+	exists, err := s.repo.ExistsByName(ctx, category.Nombre, category.Tipo)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errors.New("la categoría ya existe")
+	}
+
+	category.ID = primitive.NewObjectID()
+	if _, err := s.repo.Create(ctx, category); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// DeleteCategory elimina una categoría global. Los reportes guardan el nombre, así que no se ven afectados.
+func (s *categoryService) DeleteCategory(ctx context.Context, idStr string) error {
+	oid, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		return errors.New("categoría no encontrada")
+	}
+	res, err := s.repo.Delete(ctx, oid)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("categoría no encontrada")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// calcConfig es lo que recalcReportTotals necesita saber del usuario.
+type calcConfig struct {
+	churchEnabled bool
+	church        models.ChurchSettings
+	deductions    []models.DeductionRule // Ya ordenadas
+	carryOver     bool
+}
+
+func calcConfigFor(u *models.User) calcConfig {
+	rules := append([]models.DeductionRule(nil), u.Deductions...)
+	models.SortDeductionRules(rules)
+	return calcConfig{
+		churchEnabled: u.EnableChurchContributions,
+		church:        u.ChurchSettingsOrDefault(),
+		deductions:    rules,
+		carryOver:     u.EnableCarryOver,
+	}
+}
+
+func (s *reportService) calcConfig(ctx context.Context, userIDStr string) (calcConfig, error) {
+	oid, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return calcConfig{}, errors.New("invalid user ID")
+	}
+	u, err := s.userRepo.FindByID(ctx, oid)
+	if err != nil {
+		return calcConfig{}, errors.New("usuario no encontrado")
+	}
+	return calcConfigFor(u), nil
+}
+
+// recalcReportTotals recalcula los totales en centavos: las sumas son exactas y solo los
+// porcentajes se redondean, una vez cada uno.
+//
+// Primero van los aportes a la iglesia (si están activos), calculados sobre el bruto sin las
+// categorías excluidas ("gross") o sobre ese bruto menos los gastos del mes ("net"); como su base
+// no depende de otras deducciones van fijos en primer lugar (las reglas exigen order >= 1). Después,
+// las reglas del usuario en orden: percent_gross sobre el bruto total, percent_net sobre lo que
+// queda tras las deducciones anteriores (nunca negativo) y fixed por su importe.
+// Todo queda en report.Deducciones y IngresosNetos = bruto - TotalDeducciones.
+// El saldo inicial no se toca aquí: lo encadena refreshBalances entre meses.
+func recalcReportTotals(report *models.Report, cfg calcConfig) {
+	report.TotalIngresoBruto = sumIngresos(report.Ingresos)
+	report.TotalGastos = sumGastos(report.Gastos)
+	report.Deducciones = nil
+	report.TotalDeducciones = 0
+
+	if !cfg.churchEnabled {
+		// No poner porcentaje_ofrenda a 0: conservamos el % en BD para si el usuario
+		// vuelve a activar diezmos/ofrendas (el cliente suele enviar 0 con la opción apagada).
+		report.Diezmos = 0
+		report.Ofrendas = 0
+		report.Contribuciones = nil
+		report.Iglesia = 0
+	} else {
+		applyChurch(report, cfg.church)
+	}
+
+	for _, rule := range cfg.deductions {
+		var amount models.Money
+		switch rule.Type {
+		case models.DeductionPercentGross:
+			amount = report.TotalIngresoBruto.Percent(rule.Rate)
+		case models.DeductionPercentNet:
+			remaining := report.TotalIngresoBruto - report.TotalDeducciones
+			if remaining < 0 {
+				remaining = 0
+			}
+			amount = remaining.Percent(rule.Rate)
+		case models.DeductionFixed:
+			amount = rule.Amount
+		default:
+			continue
+		}
+		addDeduction(report, models.AppliedDeduction{RuleID: rule.ID.Hex(), Name: rule.Name, Type: rule.Type, Monto: amount})
+	}
+
+	report.IngresosNetos = report.TotalIngresoBruto - report.TotalDeducciones
+	report.Liquidacion = report.IngresosNetos - report.TotalGastos
+	report.SaldoFinal = report.SaldoInicial + report.Liquidacion
+	report.UpdatedAt = time.Now()
+}
+
+// applyChurch calcula diezmo, ofrenda y aportes con nombre y los añade al desglose.
+func applyChurch(report *models.Report, settings models.ChurchSettings) {
+	gross := report.TotalIngresoBruto
+	for _, inc := range report.Ingresos {
+		if settings.Excludes(inc.CategoriaID) {
+			gross -= inc.Monto
+		}
+	}
+	net := gross - report.TotalGastos
+	if net < 0 {
+		net = 0
+	}
+	base := func(kind string) models.Money {
+		if kind == models.ContributionBaseNet {
+			return net
+		}
+		return gross
+	}
+
+	report.Diezmos = base(settings.TitheBase).Percent(settings.TitheRate)
+	report.Ofrendas = gross.Percent(report.PorcentajeOfrenda)
+	report.Iglesia = report.Diezmos + report.Ofrendas
+	addDeduction(report, models.AppliedDeduction{RuleID: "diezmo", Name: "Diezmo", Type: models.DeductionChurch, Monto: report.Diezmos})
+	addDeduction(report, models.AppliedDeduction{RuleID: "ofrenda", Name: "Ofrenda", Type: models.DeductionChurch, Monto: report.Ofrendas})
+
+	report.Contribuciones = nil
+	for _, c := range settings.Contributions {
+		amount := base(c.Base).Percent(c.Rate)
+		report.Contribuciones = append(report.Contribuciones, models.ContributionAmount{Name: c.Name, Monto: amount})
+		report.Iglesia += amount
+		addDeduction(report, models.AppliedDeduction{RuleID: "contribucion:" + c.Name, Name: c.Name, Type: models.DeductionChurch, Monto: amount})
+	}
+}
+
+func addDeduction(report *models.Report, d models.AppliedDeduction) {
+	report.Deducciones = append(report.Deducciones, d)
+	report.TotalDeducciones += d.Monto
+}
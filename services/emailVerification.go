@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/JimcostDev/finances-api/config"
+	"github.com/JimcostDev/finances-api/mailer"
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// emailVerificationRequired: con REQUIRE_EMAIL_VERIFICATION=true no se puede iniciar sesión sin verificar el email.
+func emailVerificationRequired() bool {
+	return os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+}
+
+// emailVerificationTTL: validez del enlace de verificación (EMAIL_VERIFICATION_TTL_HOURS, 48 por defecto).
+func emailVerificationTTL() time.Duration {
+	return time.Duration(config.EnvInt("EMAIL_VERIFICATION_TTL_HOURS", 48)) * time.Hour
+}
+
+// validateEmail exige una dirección simple ("a@b.c"), sin nombre ni <>.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("email inválido")
+	}
+	return nil
+}
+
+// RequestEmailVerification envía el enlace de verificación para email (el actual o uno pendiente tras un cambio).
+func (s *authService) RequestEmailVerification(ctx context.Context, user *models.User, email string) error {
+	token, err := s.issueUserToken(ctx, user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL(), email)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", appURL(), url.QueryEscape(token))
+	msg := mailer.Message{
+		To:      email,
+		Subject: "Verifica tu email en MyFinances",
+		Body: fmt.Sprintf("Hola %s,\n\nConfirma tu dirección de correo abriendo este enlace (válido durante %d horas):\n\n%s\n\nSi no creaste esta cuenta ni cambiaste tu email, ignora este correo.\n",
+			user.Fullname, int(emailVerificationTTL().Hours()), link),
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// VerifyEmail confirma el email del token. Si era un cambio de email, el nuevo pasa a ser el activo.
+func (s *authService) VerifyEmail(ctx context.Context, req VerifyEmailRequest) error {
+	token, err := s.consumeUserToken(ctx, models.TokenPurposeEmailVerification, req.Token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return errors.New("token inválido o expirado")
+	}
+
+	update := bson.M{"$set": bson.M{"email_verified": true, "updated_at": time.Now()}}
+	emailChanged := false
+	switch token.Email {
+	case user.Email:
+	case user.PendingEmail:
+		// Alguien pudo registrar ese email mientras el cambio estaba pendiente
+		if existing, err := s.repo.FindByEmail(ctx, token.Email); err == nil && existing.ID != user.ID {
+			return errors.New("el email ya está en uso")
+		}
+		update["$set"].(bson.M)["email"] = token.Email
+		update["$unset"] = bson.M{"pending_email": ""}
+		emailChanged = true
+	default:
+		// Token de un email que ya no es ni el actual ni el pendiente
+		return errors.New("token inválido o expirado")
+	}
+
+	// El email del administrador inicial (ADMIN_EMAILS) recibe el rol al verificarse
+	if isBootstrapAdminEmail(token.Email) {
+		update["$addToSet"] = bson.M{"roles": models.RoleAdmin}
+	}
+
+	if _, err = s.repo.Update(ctx, user.ID, update); err != nil {
+		return err
+	}
+	if emailChanged {
+		s.audit.Record(ctx, user.ID, models.AuditEmailChanged, map[string]interface{}{"from": user.Email, "to": token.Email})
+	}
+	return nil
+}
+
+// ResendVerification reenvía el enlace. Como ForgotPassword, no revela si el email existe.
+func (s *authService) ResendVerification(ctx context.Context, req ResendVerificationRequest) error {
+	user, err := s.repo.FindByEmail(ctx, req.Email)
+	if err == nil && user.EmailVerified {
+		return nil
+	}
+	if err != nil {
+		if user, err = s.repo.FindByPendingEmail(ctx, req.Email); err != nil {
+			return nil
+		}
+	}
+
+	if err := s.RequestEmailVerification(ctx, user, req.Email); err != nil {
+		log.Printf("no se pudo enviar el correo de verificación a %s: %v", req.Email, err)
+	}
+	return nil
+}
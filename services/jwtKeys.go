@@ -0,0 +1,201 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jwtKey es una clave de firma/verificación identificada por su kid.
+// private es nil en claves solo de verificación (retiradas pero aún aceptadas).
+type jwtKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// JWTKeySet contiene la clave con la que se firma y todas las que se aceptan al verificar.
+// Se carga una vez al arrancar (LoadJWTKeySet), no en cada petición.
+type JWTKeySet struct {
+	signing *jwtKey
+	byKID   map[string]*jwtKey
+	hmac    *jwtKey // JWT_SECRET_KEY: tokens HS256 sin "kid"
+}
+
+// LoadJWTKeySet lee la configuración de claves:
+//   - JWT_KEYS_DIR: carpeta con ficheros PEM "<kid>.pem" (RSA → RS256, Ed25519 → EdDSA).
+//     Un fichero con clave privada puede firmar; uno con solo "PUBLIC KEY" únicamente verifica.
+//   - JWT_SIGNING_KEY_ID: kid con el que se firma; por defecto la última clave privada por nombre.
+//   - JWT_SECRET_KEY: secreto HS256. Sin JWT_KEYS_DIR es la clave de firma; con ella solo
+//     se usa para aceptar los tokens HS256 emitidos antes de migrar.
+func LoadJWTKeySet() (*JWTKeySet, error) {
+	ks := &JWTKeySet{byKID: make(map[string]*jwtKey)}
+
+	if secret := os.Getenv("JWT_SECRET_KEY"); secret != "" {
+		ks.hmac = &jwtKey{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	}
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if ks.hmac == nil {
+			return nil, errors.New("JWT_SECRET_KEY o JWT_KEYS_DIR deben estar definidas")
+		}
+		ks.signing = ks.hmac
+		return ks, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var lastPrivate *jwtKey
+	for _, file := range files {
+		key, err := loadPEMKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("clave JWT %s: %w", file, err)
+		}
+		ks.byKID[key.id] = key
+		if key.private != nil {
+			lastPrivate = key
+		}
+	}
+
+	if kid := os.Getenv("JWT_SIGNING_KEY_ID"); kid != "" {
+		key, ok := ks.byKID[kid]
+		if !ok || key.private == nil {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_ID %q no tiene clave privada en %s", kid, dir)
+		}
+		ks.signing = key
+	} else {
+		ks.signing = lastPrivate
+	}
+	if ks.signing == nil {
+		return nil, fmt.Errorf("no hay ninguna clave privada en %s", dir)
+	}
+	return ks, nil
+}
+
+// loadPEMKey interpreta un PEM con clave privada (PKCS#8 o PKCS#1) o pública (PKIX).
+func loadPEMKey(file string) (*jwtKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("PEM inválido")
+	}
+	key := &jwtKey{id: strings.TrimSuffix(filepath.Base(file), ".pem")}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("tipo PEM %q no soportado", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.private.(type) {
+	case *rsa.PrivateKey:
+		key.public = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.public = k.Public()
+	}
+	switch key.public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("solo se admiten claves RSA y Ed25519")
+	}
+	return key, nil
+}
+
+// sign firma los claims con la clave activa (cabecera "kid" salvo en HS256).
+func (ks *JWTKeySet) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	if ks.signing.id != "" {
+		token.Header["kid"] = ks.signing.id
+	}
+	t, err := token.SignedString(ks.signing.private)
+	if err != nil {
+		return "", errors.New("no se pudo generar el token")
+	}
+	return t, nil
+}
+
+// parse verifica firma y expiración con la clave indicada por "kid" y devuelve los claims.
+// El algoritmo debe coincidir con el de la clave (evita la confusión RS256/HS256).
+func (ks *JWTKeySet) parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		key := ks.hmac
+		if kid, _ := token.Header["kid"].(string); kid != "" {
+			key = ks.byKID[kid]
+		}
+		if key == nil || token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("método de firma inválido")
+		}
+		return key.public, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("token inválido")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("token inválido")
+	}
+	return claims, nil
+}
+
+// JWKS devuelve las claves públicas (RFC 7517) para que otros servicios verifiquen nuestros tokens.
+// Las claves HMAC nunca se publican.
+func (ks *JWTKeySet) JWKS() map[string]interface{} {
+	kids := make([]string, 0, len(ks.byKID))
+	for kid := range ks.byKID {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := make([]map[string]interface{}, 0, len(kids))
+	for _, kid := range kids {
+		key := ks.byKID[kid]
+		jwk := map[string]interface{}{
+			"kid": key.id,
+			"use": "sig",
+			"alg": key.method.Alg(),
+		}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
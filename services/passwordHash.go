@@ -0,0 +1,95 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Parámetros argon2id (mínimos recomendados por OWASP). Cambiarlos hace que los hashes
+// existentes se regeneren en el siguiente login correcto.
+const (
+	argon2Memory  uint32 = 19 * 1024 // KiB
+	argon2Time    uint32 = 2
+	argon2Threads uint8  = 1
+	argon2KeyLen  uint32 = 32
+	argon2SaltLen        = 16
+)
+
+// passwordHashAlgorithm: "argon2id" (por defecto) o "bcrypt" (PASSWORD_HASH_ALGORITHM).
+func passwordHashAlgorithm() string {
+	if os.Getenv("PASSWORD_HASH_ALGORITHM") == "bcrypt" {
+		return "bcrypt"
+	}
+	return "argon2id"
+}
+
+// hashPassword genera el hash con el algoritmo configurado.
+// argon2id se guarda en formato PHC: $argon2id$v=19$m=...,t=...,p=...$salt$hash
+func hashPassword(password string) (string, error) {
+	if passwordHashAlgorithm() == "bcrypt" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", errors.New("error al encriptar la contraseña")
+		}
+		return string(hashed), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.New("error al encriptar la contraseña")
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword comprueba la contraseña contra un hash bcrypt o argon2id.
+// needsRehash indica que el hash es de otro algoritmo o parámetros distintos a los actuales.
+func verifyPassword(hash, password string) (ok bool, needsRehash bool) {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false, false
+		}
+		return true, passwordHashAlgorithm() != "bcrypt"
+	}
+
+	var version int
+	var memory, iterations uint32
+	var threads uint8
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false
+	}
+	outdated := memory != argon2Memory || iterations != argon2Time || threads != argon2Threads ||
+		uint32(len(key)) != argon2KeyLen || passwordHashAlgorithm() != "argon2id"
+	return true, outdated
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JimcostDev/finances-api/config"
+)
+
+// Códigos de incumplimiento de la política de contraseñas
+const (
+	PasswordTooShort        = "too_short"
+	PasswordTooLong         = "too_long"
+	PasswordBreached        = "breached"
+	PasswordMatchesIdentity = "matches_identity"
+)
+
+// PasswordViolation es una regla de la política que la contraseña no cumple.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError agrupa todos los incumplimientos para devolverlos juntos al cliente.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "la contraseña no cumple la política"
+}
+
+// validatePassword aplica la política configurada:
+//   - PASSWORD_MIN_LENGTH (8 por defecto) y PASSWORD_MAX_LENGTH (128) en caracteres.
+//   - No puede ser igual al email, a su parte local ni al username (sin distinguir mayúsculas).
+//   - PASSWORD_BREACHED_LIST: fichero local de hashes SHA-1 filtrados, ordenado por hash
+//     (formato "HASH:CONTADOR" de Have I Been Pwned). Se consulta localmente, nunca se envía la contraseña.
+func validatePassword(password, email, username string) error {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if min := config.EnvInt("PASSWORD_MIN_LENGTH", 8); length < min {
+		violations = append(violations, PasswordViolation{PasswordTooShort, fmt.Sprintf("debe tener al menos %d caracteres", min)})
+	}
+	if max := config.EnvInt("PASSWORD_MAX_LENGTH", 128); length > max {
+		violations = append(violations, PasswordViolation{PasswordTooLong, fmt.Sprintf("no puede superar los %d caracteres", max)})
+	}
+
+	lower := strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	localPart, _, _ := strings.Cut(email, "@")
+	for _, identity := range []string{email, localPart, strings.ToLower(strings.TrimSpace(username))} {
+		if identity != "" && lower == identity {
+			violations = append(violations, PasswordViolation{PasswordMatchesIdentity, "no puede ser igual a tu email ni a tu nombre de usuario"})
+			break
+		}
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" && password != "" {
+		breached, err := passwordInBreachedList(path, password)
+		if err != nil {
+			// Si la lista no está disponible se registra y se sigue: no bloquea registros ni cambios
+			log.Printf("no se pudo consultar la lista de contraseñas filtradas: %v", err)
+		} else if breached {
+			violations = append(violations, PasswordViolation{PasswordBreached, "aparece en filtraciones de datos conocidas; elige otra"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// passwordInBreachedList busca el SHA-1 de la contraseña con búsqueda binaria sobre el fichero ordenado,
+// sin cargarlo en memoria (la lista completa ocupa decenas de GB).
+func passwordInBreachedList(path, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Invariante: si la línea buscada existe, empieza en [lo, hi); lo siempre es inicio de línea.
+	lo, hi := int64(0), info.Size()
+	for hi-lo > 4096 {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineAfter(f, mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+		switch key := breachedKey(line); {
+		case key == target:
+			return true, nil
+		case key < target:
+			lo = start
+		default:
+			hi = start
+		}
+	}
+
+	// Tramo final: lectura secuencial de las líneas que empiezan antes de hi
+	r := bufio.NewReader(io.NewSectionReader(f, lo, info.Size()-lo))
+	for pos := lo; pos < hi; {
+		line, err := r.ReadString('\n')
+		if line != "" && breachedKey(line) == target {
+			return true, nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		pos += int64(len(line))
+	}
+	return false, nil
+}
+
+// lineAfter devuelve la primera línea completa que empieza después de la posición off.
+func lineAfter(f *os.File, off int64) (int64, string, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, off, 1<<62))
+	skipped, err := r.ReadString('\n')
+	if err == io.EOF {
+		return 1 << 62, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	if line == "" {
+		return 1 << 62, "", nil
+	}
+	return off + int64(len(skipped)), line, nil
+}
+
+// breachedKey extrae el hash de una línea "HASH:CONTADOR" en mayúsculas.
+func breachedKey(line string) string {
+	key, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(key)
+}
+
+// AsPasswordPolicyError permite a los handlers devolver los incumplimientos estructurados.
+func AsPasswordPolicyError(err error) (*PasswordPolicyError, bool) {
+	var policyErr *PasswordPolicyError
+	ok := errors.As(err, &policyErr)
+	return policyErr, ok
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JimcostDev/finances-api/config"
+	"github.com/JimcostDev/finances-api/mailer"
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+// appURL es la URL base del frontend para los enlaces de los correos (APP_URL).
+func appURL() string {
+	if v := os.Getenv("APP_URL"); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return "https://finances.jimcostdev.com"
+}
+
+// passwordResetTTL: validez del enlace de recuperación (PASSWORD_RESET_TTL_MINUTES, 60 por defecto).
+func passwordResetTTL() time.Duration {
+	return time.Duration(config.EnvInt("PASSWORD_RESET_TTL_MINUTES", 60)) * time.Minute
+}
+
+// issueUserToken invalida los tokens pendientes del mismo propósito y crea uno nuevo; devuelve el token en claro.
+// email solo se usa en la verificación de email (dirección a confirmar).
+func (s *authService) issueUserToken(ctx context.Context, userID primitive.ObjectID, purpose string, ttl time.Duration, email string) (string, error) {
+	if _, err := s.userTokens.InvalidateAll(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	plain, err := generateOpaqueToken()
+	if err != nil {
+		return "", errors.New("no se pudo generar el token")
+	}
+	now := time.Now()
+	_, err = s.userTokens.Create(ctx, models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(plain),
+		Email:     email,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// consumeUserToken valida y marca como usado un token; es de un solo uso incluso con peticiones concurrentes.
+func (s *authService) consumeUserToken(ctx context.Context, purpose, plain string) (*models.UserToken, error) {
+	if plain == "" {
+		return nil, errors.New("token inválido o expirado")
+	}
+	token, err := s.userTokens.FindValid(ctx, purpose, hashToken(plain))
+	if err != nil {
+		return nil, errors.New("token inválido o expirado")
+	}
+	res, err := s.userTokens.MarkUsed(ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("token inválido o expirado")
+	}
+	return token, nil
+}
+
+// ForgotPassword envía el enlace de recuperación. No revela si el email existe:
+// el resultado para el cliente es el mismo en ambos casos.
+func (s *authService) ForgotPassword(ctx context.Context, req ForgotPasswordRequest) error {
+	user, err := s.repo.FindByEmail(ctx, req.Email)
+	if err != nil {
+		return nil
+	}
+
+	if err := s.sendPasswordReset(ctx, user, "Si no lo solicitaste, ignora este correo."); err != nil {
+		if errors.Is(err, errMailNotSent) {
+			// Se registra pero no se devuelve, para no distinguir usuarios existentes por el código de respuesta
+			log.Printf("no se pudo enviar el correo de recuperación a %s: %v", user.Email, err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// errMailNotSent envuelve los fallos del Mailer para distinguirlos de los de base de datos.
+var errMailNotSent = errors.New("no se pudo enviar el correo")
+
+// sendPasswordReset emite un token de recuperación y envía el enlace al usuario.
+func (s *authService) sendPasswordReset(ctx context.Context, user *models.User, note string) error {
+	token, err := s.issueUserToken(ctx, user.ID, models.TokenPurposePasswordReset, passwordResetTTL(), "")
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", appURL(), url.QueryEscape(token))
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Restablecer tu contraseña de MyFinances",
+		Body: fmt.Sprintf("Hola %s,\n\nPara elegir una nueva contraseña abre este enlace (válido durante %d minutos):\n\n%s\n\n%s\n",
+			user.Fullname, int(passwordResetTTL().Minutes()), link, note),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("%w: %v", errMailNotSent, err)
+	}
+	return nil
+}
+
+// RequirePasswordReset (administración) bloquea el login hasta que el usuario elija una contraseña nueva:
+// cierra todas sus sesiones y le envía el enlace de recuperación.
+func (s *authService) RequirePasswordReset(ctx context.Context, user *models.User) error {
+	_, err := s.repo.Update(ctx, user.ID, bson.M{"$set": bson.M{
+		"password_reset_required": true,
+		"updated_at":              time.Now(),
+	}})
+	if err != nil {
+		return err
+	}
+	if _, err := s.sessions.RevokeAllByUser(ctx, user.ID, primitive.NilObjectID); err != nil {
+		return err
+	}
+	return s.sendPasswordReset(ctx, user, "Un administrador ha solicitado que cambies tu contraseña; no podrás iniciar sesión hasta hacerlo.")
+}
+
+// ResetPassword cambia la contraseña con un token de recuperación y cierra todas las sesiones del usuario.
+func (s *authService) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	if req.Password == "" {
+		return errors.New("la contraseña es obligatoria")
+	}
+	if req.Password != req.ConfirmPassword {
+		return errors.New("las contraseñas no coinciden")
+	}
+
+	// La política se valida antes de consumir el token, para poder reintentar con otra contraseña
+	pending, err := s.userTokens.FindValid(ctx, models.TokenPurposePasswordReset, hashToken(req.Token))
+	if err != nil {
+		return errors.New("token inválido o expirado")
+	}
+	user, err := s.repo.FindByID(ctx, pending.UserID)
+	if err != nil {
+		return errors.New("token inválido o expirado")
+	}
+	if err := validatePassword(req.Password, user.Email, user.Username); err != nil {
+		return err
+	}
+
+	token, err := s.consumeUserToken(ctx, models.TokenPurposePasswordReset, req.Token)
+	if err != nil {
+		return err
+	}
+
+	hashed, err := hashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+	res, err := s.repo.Update(ctx, token.UserID, bson.M{
+		"$set":   bson.M{"password": hashed, "updated_at": time.Now()},
+		"$unset": bson.M{"password_reset_required": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("token inválido o expirado")
+	}
+
+	s.audit.Record(ctx, token.UserID, models.AuditPasswordReset, nil)
+
+	// Quien tuviera la contraseña anterior pierde el acceso
+	_, err = s.sessions.RevokeAllByUser(ctx, token.UserID, primitive.NilObjectID)
+	return err
+}
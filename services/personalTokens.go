@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// personalTokenPrefix distingue los tokens personales de los JWT en Authorization: Bearer.
+const personalTokenPrefix = "fpat_"
+
+// Métodos de autenticación de un Principal.
+const (
+	AuthMethodSession       = "session"
+	AuthMethodPersonalToken = "personal_token"
+)
+
+type CreatePersonalTokenRequest struct {
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`      // "read" | "read_write"
+	ExpiresAt *time.Time `json:"expires_at"` // opcional; sin valor no caduca
+}
+
+// CreatedPersonalToken incluye el valor en claro, que solo se devuelve al crearlo.
+type CreatedPersonalToken struct {
+	models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// CreatePersonalToken crea un token personal para el usuario.
+func (s *authService) CreatePersonalToken(ctx context.Context, userIDStr string, req CreatePersonalTokenRequest) (*CreatedPersonalToken, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, errors.New("el nombre del token es obligatorio")
+	}
+	if req.Scope == "" {
+		req.Scope = models.TokenScopeRead
+	}
+	if req.Scope != models.TokenScopeRead && req.Scope != models.TokenScopeReadWrite {
+		return nil, errors.New("scope inválido (read | read_write)")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("la fecha de expiración debe ser futura")
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return nil, errors.New("no se pudo generar el token")
+	}
+	plain := personalTokenPrefix + secret
+
+	token := models.PersonalAccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    plain[:len(personalTokenPrefix)+6],
+		TokenHash: hashToken(plain),
+		Scope:     req.Scope,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.personalTokens.Create(ctx, token); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, userID, models.AuditTokenCreated, map[string]interface{}{
+		"token_id": token.ID.Hex(),
+		"name":     token.Name,
+		"scope":    token.Scope,
+	})
+	return &CreatedPersonalToken{PersonalAccessToken: token, Token: plain}, nil
+}
+
+// ListPersonalTokens lista los tokens del usuario (sin el valor).
+func (s *authService) ListPersonalTokens(ctx context.Context, userIDStr string) ([]models.PersonalAccessToken, error) {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+	tokens, err := s.personalTokens.FindAllByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		tokens = []models.PersonalAccessToken{}
+	}
+	return tokens, nil
+}
+
+// DeletePersonalToken revoca un token del usuario.
+func (s *authService) DeletePersonalToken(ctx context.Context, userIDStr, tokenIDStr string) error {
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return errors.New("ID inválido")
+	}
+	tokenID, err := primitive.ObjectIDFromHex(tokenIDStr)
+	if err != nil {
+		return errors.New("token no encontrado")
+	}
+
+	res, err := s.personalTokens.Delete(ctx, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("token no encontrado")
+	}
+	s.audit.Record(ctx, userID, models.AuditTokenDeleted, map[string]interface{}{"token_id": tokenIDStr})
+	return nil
+}
+
+// authenticatePersonalToken valida un token personal presentado como Bearer.
+func (s *authService) authenticatePersonalToken(ctx context.Context, plain string) (*Principal, error) {
+	token, err := s.personalTokens.FindByHash(ctx, hashToken(plain))
+	if err != nil {
+		return nil, errors.New("token inválido")
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, errors.New("token expirado")
+	}
+
+	user, err := s.repo.FindByID(ctx, token.UserID)
+	if err != nil || checkAccountActive(user) != nil {
+		return nil, errors.New("cuenta deshabilitada")
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		_, _ = s.personalTokens.Touch(ctx, token.ID, now)
+	}
+
+	return &Principal{
+		UserID:     token.UserID.Hex(),
+		AuthMethod: AuthMethodPersonalToken,
+		Scope:      token.Scope,
+		Roles:      user.Roles,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errReportClosed: el reporte está cerrado y hay que reabrirlo antes de modificarlo o borrarlo.
+var errReportClosed = errors.New("el reporte está cerrado; reábrelo para modificarlo")
+
+const maxClosureReason = 500
+
+// CloseReport cierra el periodo: desde entonces el reporte conserva sus cifras (ni las ediciones ni
+// los recálculos por cambios de configuración lo tocan). reason es opcional.
+func (s *reportService) CloseReport(ctx context.Context, reportID, userIDStr string, version int64, reason string) (*models.Report, error) {
+	return s.setClosed(ctx, reportID, userIDStr, version, true, reason)
+}
+
+// ReopenReport vuelve a permitir cambios; el motivo es obligatorio y queda en el historial.
+func (s *reportService) ReopenReport(ctx context.Context, reportID, userIDStr string, version int64, reason string) (*models.Report, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("motivo requerido para reabrir el reporte")
+	}
+	return s.setClosed(ctx, reportID, userIDStr, version, false, reason)
+}
+
+func (s *reportService) setClosed(ctx context.Context, reportID, userIDStr string, version int64, closed bool, reason string) (*models.Report, error) {
+	oid, err := primitive.ObjectIDFromHex(reportID)
+	if err != nil {
+		return nil, errors.New("invalid report ID")
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxClosureReason {
+		return nil, errors.New("motivo demasiado largo (máximo 500 caracteres)")
+	}
+
+	cfg, err := s.calcConfig(ctx, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// El cambio de estado, los totales y el reencadenado de los saldos van en la misma transacción
+	var report *models.Report
+	err = s.inTransaction(ctx, func(ctx context.Context) error {
+		report, err = s.updateClosed(ctx, oid, userObjID, cfg, version, closed, reason)
+		if err != nil {
+			return err
+		}
+		// Los totales pudieron cambiar al recalcularlos y, tras una reapertura, la cadena de saldos
+		// pudo moverse mientras estuvo cerrado: se vuelve a enlazar
+		return s.propagateBalances(ctx, userObjID, cfg, periodIndex(report), report)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// updateClosed guarda el nuevo estado y la entrada del historial si el reporte sigue en la versión leída.
+// Los totales se recalculan con la configuración actual sobre los items guardados y se escriben en el
+// mismo update: al cerrar, las cifras que se congelan siempre cuadran con los items; al reabrir, el
+// reporte deja de arrastrar las de cuando se cerró.
+func (s *reportService) updateClosed(ctx context.Context, oid, userObjID primitive.ObjectID, cfg calcConfig, version int64, closed bool, reason string) (*models.Report, error) {
+	report, err := s.repo.FindOne(ctx, oid, userObjID)
+	if err != nil {
+		return nil, errors.New("not found")
+	}
+	if version != AnyVersion && report.Version != version {
+		return nil, errVersionMismatch
+	}
+	if report.Cerrado == closed {
+		if closed {
+			return nil, errors.New("el reporte ya está cerrado")
+		}
+		return nil, errors.New("el reporte no está cerrado")
+	}
+
+	recalcReportTotals(report, cfg)
+	now := time.Now()
+	action := models.ReportReopened
+	set := totalsSet(report)
+	set["cerrado"] = closed
+	set["updated_at"] = now
+	if closed {
+		action = models.ReportClosed
+		set["cerrado_en"] = now
+	}
+	entry := models.ReportClosure{Action: action, Reason: reason, At: now}
+	update := bson.M{"$set": set, "$push": bson.M{"cierres": entry}}
+	if !closed {
+		update["$unset"] = bson.M{"cerrado_en": ""}
+	}
+
+	res, err := s.repo.UpdateIfVersion(ctx, oid, userObjID, report.Version, update)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		if version == AnyVersion {
+			return nil, errConcurrentUpdate
+		}
+		return nil, errVersionMismatch
+	}
+
+	report.Cerrado = closed
+	report.CerradoEn = nil
+	if closed {
+		report.CerradoEn = &now
+	}
+	report.Cierres = append(report.Cierres, entry)
+	report.UpdatedAt = now
+	report.Version++
+	return report, nil
+}
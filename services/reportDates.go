@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCashFlowDays limita el rango del flujo de caja diario.
+const maxCashFlowDays = 366
+
+// DateRange es un rango de fechas de calendario inclusivo; un extremo vacío queda abierto.
+type DateRange struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// ParseDateRange valida from/to (AAAA-MM-DD). Las fechas en ese formato se comparan como texto.
+func ParseDateRange(from, to string) (DateRange, error) {
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(models.DateLayout, d); err != nil {
+			return DateRange{}, errors.New("fecha inválida (AAAA-MM-DD)")
+		}
+	}
+	if from != "" && to != "" && from > to {
+		return DateRange{}, errors.New("fecha inválida: from es posterior a to")
+	}
+	return DateRange{From: from, To: to}, nil
+}
+
+// IsZero indica que no se pidió rango.
+func (r DateRange) IsZero() bool {
+	return r.From == "" && r.To == ""
+}
+
+// Contains indica si un item con esa fecha entra en el rango. Con rango, los items sin fecha no entran.
+func (r DateRange) Contains(fecha string) bool {
+	if r.IsZero() {
+		return true
+	}
+	if fecha == "" {
+		return false
+	}
+	return (r.From == "" || fecha >= r.From) && (r.To == "" || fecha <= r.To)
+}
+
+// IncludesReport indica si el mes del reporte tiene algún día dentro del rango (sin rango, todos).
+func (r DateRange) IncludesReport(report *models.Report) bool {
+	if r.IsZero() {
+		return true
+	}
+	period, err := reportPeriod(report)
+	if err != nil {
+		return false
+	}
+	// Como AAAA-MM se compara con el primer y el último mes del rango
+	month := time.Date(period.Year, time.Month(period.Month), 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+	return (r.From == "" || month >= r.From[:7]) && (r.To == "" || month <= r.To[:7])
+}
+
+// ItemsInRange son los items de un reporte filtrados por fecha y sus sumas.
+type ItemsInRange struct {
+	DateRange
+	Ingresos      []models.Income  `json:"ingresos"`
+	Gastos        []models.Expense `json:"gastos"`
+	TotalIngresos models.Money     `json:"total_ingresos"`
+	TotalGastos   models.Money     `json:"total_gastos"`
+}
+
+// FilterReportItems devuelve los ingresos y gastos del reporte cuya fecha está en el rango.
+func FilterReportItems(report *models.Report, rng DateRange) ItemsInRange {
+	out := ItemsInRange{DateRange: rng, Ingresos: []models.Income{}, Gastos: []models.Expense{}}
+	for _, inc := range report.Ingresos {
+		if rng.Contains(inc.Fecha) {
+			out.Ingresos = append(out.Ingresos, inc)
+			out.TotalIngresos += inc.Monto
+		}
+	}
+	for _, exp := range report.Gastos {
+		if rng.Contains(exp.Fecha) {
+			out.Gastos = append(out.Gastos, exp)
+			out.TotalGastos += exp.Monto
+		}
+	}
+	return out
+}
+
+// normalizeItemDates valida y completa la fecha de todos los items contra el periodo del reporte.
+func normalizeItemDates(ingresos []models.Income, gastos []models.Expense, period models.Period) error {
+	for i := range ingresos {
+		if err := ingresos[i].ItemDate.Normalize(period); err != nil {
+			return err
+		}
+	}
+	for i := range gastos {
+		if err := gastos[i].ItemDate.Normalize(period); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportPeriod es el periodo canónico de un reporte ya guardado.
+func reportPeriod(report *models.Report) (models.Period, error) {
+	return models.ParsePeriod(report.Month, report.Year)
+}
+
+// CashFlowDay es el movimiento de un día; Saldo acumula desde el inicio del rango.
+type CashFlowDay struct {
+	Fecha    string       `json:"fecha"`
+	Ingresos models.Money `json:"ingresos"`
+	Gastos   models.Money `json:"gastos"`
+	Neto     models.Money `json:"neto"`
+	Saldo    models.Money `json:"saldo"`
+}
+
+// CashFlow es el flujo de caja diario de un rango. SinFecha suma los items sin fecha
+// de los reportes cuyo mes cae en el rango (no se pueden asignar a un día).
+type CashFlow struct {
+	DateRange
+	Days          []CashFlowDay `json:"days"`
+	TotalIngresos models.Money  `json:"total_ingresos"`
+	TotalGastos   models.Money  `json:"total_gastos"`
+	Neto          models.Money  `json:"neto"`
+	SinFecha      struct {
+		Ingresos models.Money `json:"ingresos"`
+		Gastos   models.Money `json:"gastos"`
+	} `json:"sin_fecha"`
+}
+
+// GetCashFlow agrupa por día los ingresos y gastos fechados del usuario en el rango (ambos extremos obligatorios).
+func (s *reportService) GetCashFlow(ctx context.Context, userIDStr string, rng DateRange) (*CashFlow, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
+	}
+	if rng.From == "" || rng.To == "" {
+		return nil, errors.New("fecha inválida: from y to son obligatorios")
+	}
+	from, _ := time.Parse(models.DateLayout, rng.From)
+	to, _ := time.Parse(models.DateLayout, rng.To)
+	days := int(to.Sub(from).Hours()/24) + 1
+	if days > maxCashFlowDays {
+		return nil, errors.New("fecha inválida: el rango no puede superar 366 días")
+	}
+
+	reports, err := s.repo.FindAll(ctx, userObjID)
+	if err != nil {
+		return nil, err
+	}
+
+	flow := &CashFlow{DateRange: rng, Days: make([]CashFlowDay, days)}
+	index := make(map[string]int, days)
+	for i := range flow.Days {
+		fecha := from.AddDate(0, 0, i).Format(models.DateLayout)
+		flow.Days[i].Fecha = fecha
+		index[fecha] = i
+	}
+	for i := range reports {
+		r := &reports[i]
+		if !rng.IncludesReport(r) {
+			continue
+		}
+		for _, inc := range r.Ingresos {
+			if inc.Fecha == "" {
+				flow.SinFecha.Ingresos += inc.Monto
+			} else if d, ok := index[inc.Fecha]; ok {
+				flow.Days[d].Ingresos += inc.Monto
+			}
+		}
+		for _, exp := range r.Gastos {
+			if exp.Fecha == "" {
+				flow.SinFecha.Gastos += exp.Monto
+			} else if d, ok := index[exp.Fecha]; ok {
+				flow.Days[d].Gastos += exp.Monto
+			}
+		}
+	}
+
+	var saldo models.Money
+	for i := range flow.Days {
+		day := &flow.Days[i]
+		day.Neto = day.Ingresos - day.Gastos
+		saldo += day.Neto
+		day.Saldo = saldo
+		flow.TotalIngresos += day.Ingresos
+		flow.TotalGastos += day.Gastos
+	}
+	flow.Neto = flow.TotalIngresos - flow.TotalGastos
+	return flow, nil
+}
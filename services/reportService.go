@@ -2,8 +2,11 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
+	"strconv"
 	"time"
 
 	"github.com/JimcostDev/finances-api/models"
@@ -15,7 +18,7 @@ import (
 
 type ReportService interface {
 	CreateReport(ctx context.Context, userID string, req ReportRequest) (*models.Report, error)
-	UpdateReport(ctx context.Context, reportID string, userID string, req ReportRequest) (interface{}, error)
+	UpdateReport(ctx context.Context, reportID string, userID string, version int64, req ReportRequest) (map[string]interface{}, error)
 	GetReports(ctx context.Context, userID string) ([]models.Report, error)
 	GetReportByID(ctx context.Context, reportID string, userID string) (*models.Report, error)
 	GetReportsByMonth(ctx context.Context, userID string, month string, year int) ([]models.Report, error)
@@ -24,15 +27,24 @@ type ReportService interface {
 	// --- Métodos de Análisis Financiero ---
 	GetAnnualReport(ctx context.Context, userID string, year int) (bson.M, error)
 	GetGeneralBalance(ctx context.Context, userID string) (bson.M, error)
+	GetCashFlow(ctx context.Context, userID string, rng DateRange) (*CashFlow, error)
 
 	// Métodos para items individuales
-	AddIncome(ctx context.Context, reportID, userID string, income models.Income) (*models.Report, error)
-	AddExpense(ctx context.Context, reportID, userID string, expense models.Expense) (*models.Report, error)
-	RemoveIncome(ctx context.Context, reportID, userID, incomeID string) (*models.Report, error)
-	RemoveExpense(ctx context.Context, reportID, userID, expenseID string) (*models.Report, error)
-
-	// RecalculateAllReportsForUser reaplica la lógica de iglesia a todos los reportes (p. ej. al activar diezmos/ofrendas en el perfil).
-	RecalculateAllReportsForUser(ctx context.Context, userIDStr string, churchEnabled bool) error
+	// version es la que el cliente leyó (If-Match) o AnyVersion
+	AddIncome(ctx context.Context, reportID, userID string, version int64, income models.Income) (*models.Report, error)
+	AddExpense(ctx context.Context, reportID, userID string, version int64, expense models.Expense) (*models.Report, error)
+	RemoveIncome(ctx context.Context, reportID, userID string, version int64, incomeID string) (*models.Report, error)
+	RemoveExpense(ctx context.Context, reportID, userID string, version int64, expenseID string) (*models.Report, error)
+	UpdateIncome(ctx context.Context, reportID, userID string, version int64, incomeID string, patch ItemPatch) (*models.Report, error)
+	UpdateExpense(ctx context.Context, reportID, userID string, version int64, expenseID string, patch ItemPatch) (*models.Report, error)
+
+	// Cierre de periodos: un reporte cerrado no admite cambios hasta reabrirlo con un motivo
+	CloseReport(ctx context.Context, reportID, userID string, version int64, reason string) (*models.Report, error)
+	ReopenReport(ctx context.Context, reportID, userID string, version int64, reason string) (*models.Report, error)
+
+	// RecalculateAllReportsForUser reaplica la lógica de iglesia, las deducciones y el arrastre de saldos del perfil
+	// a todos los reportes abiertos; los cerrados no se tocan.
+	RecalculateAllReportsForUser(ctx context.Context, userIDStr string) error
 }
 
 // Estructura auxiliar para recibir datos (la moví del handler aquí)
@@ -44,74 +56,112 @@ type ReportRequest struct {
 	PorcentajeOfrenda float64          `json:"porcentaje_ofrenda"`
 }
 
-type reportService struct {
-	repo     repositories.ReportRepository
-	userRepo repositories.UserRepository
+// ItemPatch es la edición parcial de un ingreso o gasto: solo se cambian los campos presentes.
+type ItemPatch struct {
+	Concepto    *string          `json:"concepto"`
+	Monto       *models.Money    `json:"monto"`
+	CategoriaID OptionalObjectID `json:"categoria_id"`
+	Fecha       *string          `json:"fecha"` // "" quita la fecha
+	FechaHora   OptionalTime     `json:"fecha_hora"`
+	ZonaHoraria *string          `json:"zona_horaria"`
 }
 
-func NewReportService(repo repositories.ReportRepository, userRepo repositories.UserRepository) ReportService {
-	return &reportService{repo: repo, userRepo: userRepo}
+// OptionalTime distingue un campo ausente de uno enviado como null.
+type OptionalTime struct {
+	Set   bool
+	Value *time.Time
 }
 
-func (s *reportService) churchContributionsEnabled(ctx context.Context, userIDStr string) (bool, error) {
-	oid, err := primitive.ObjectIDFromHex(userIDStr)
-	if err != nil {
-		return false, errors.New("invalid user ID")
+func (o *OptionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
 	}
-	u, err := s.userRepo.FindByID(ctx, oid)
-	if err != nil {
-		return false, errors.New("usuario no encontrado")
+	var t time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		return errors.New("fecha_hora inválida (RFC 3339)")
 	}
-	return u.EnableChurchContributions, nil
+	o.Value = &t
+	return nil
 }
 
-// --- Helpers de Lógica de Negocio ---
-func roundToTwoDecimals(value float64) float64 {
-	return math.Round(value*100) / 100
+// OptionalObjectID distingue un campo ausente (Set == false) de uno enviado como null (quitar la categoría).
+type OptionalObjectID struct {
+	Set   bool
+	Value *primitive.ObjectID
 }
 
-func recalcReportTotalsWithChurch(report *models.Report, churchEnabled bool) {
-	totalIngresoBruto := 0.0
-	for _, inc := range report.Ingresos {
-		totalIngresoBruto += inc.Monto
+func (o *OptionalObjectID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
 	}
-
-	totalGastos := 0.0
-	for _, exp := range report.Gastos {
-		totalGastos += exp.Monto
+	var hex string
+	if err := json.Unmarshal(data, &hex); err != nil {
+		return errors.New("categoria_id inválido")
+	}
+	oid, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return errors.New("categoria_id inválido")
 	}
+	o.Value = &oid
+	return nil
+}
+
+func (p ItemPatch) empty() bool {
+	return p.Concepto == nil && p.Monto == nil && !p.CategoriaID.Set &&
+		p.Fecha == nil && !p.FechaHora.Set && p.ZonaHoraria == nil
+}
+
+type reportService struct {
+	repo     repositories.ReportRepository
+	userRepo repositories.UserRepository
+	client   *mongo.Client // Necesario para transacciones
+}
+
+func NewReportService(repo repositories.ReportRepository, userRepo repositories.UserRepository, client *mongo.Client) ReportService {
+	return &reportService{repo: repo, userRepo: userRepo, client: client}
+}
 
-	report.TotalIngresoBruto = roundToTwoDecimals(totalIngresoBruto)
-	report.TotalGastos = roundToTwoDecimals(totalGastos)
+// AnyVersion acepta cualquier versión del reporte (If-Match: *).
+const AnyVersion int64 = -1
 
-	if !churchEnabled {
-		// No poner porcentaje_ofrenda a 0: conservamos el % en BD para si el usuario
-		// vuelve a activar diezmos/ofrendas (el cliente suele enviar 0 con la opción apagada).
-		report.Diezmos = 0
-		report.Ofrendas = 0
-		report.Iglesia = 0
-		report.IngresosNetos = report.TotalIngresoBruto
-	} else {
-		report.Diezmos = roundToTwoDecimals(totalIngresoBruto * 0.1)
-		report.Ofrendas = roundToTwoDecimals(totalIngresoBruto * report.PorcentajeOfrenda)
-		report.Iglesia = roundToTwoDecimals(report.Diezmos + report.Ofrendas)
-		report.IngresosNetos = roundToTwoDecimals(totalIngresoBruto - report.Iglesia)
+// errVersionMismatch: el cliente editó una versión del reporte que ya no es la actual.
+var errVersionMismatch = errors.New("el reporte cambió desde que lo leíste")
+
+// errDuplicatePeriod: solo puede haber un reporte por usuario, mes y año.
+var errDuplicatePeriod = errors.New("ya existe un reporte para ese mes y año")
+
+// checkPeriodAvailable comprueba que el periodo no tenga ya otro reporte del usuario.
+// El índice único lo garantiza; esto solo da el error antes de escribir.
+func (s *reportService) checkPeriodAvailable(ctx context.Context, userID primitive.ObjectID, period models.Period, excludeID primitive.ObjectID) error {
+	exists, err := s.repo.ExistsForPeriod(ctx, userID, period.MonthName(), period.Year, excludeID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errDuplicatePeriod
 	}
+	return nil
+}
 
-	report.Liquidacion = roundToTwoDecimals(report.IngresosNetos - report.TotalGastos)
-	report.UpdatedAt = time.Now()
+// --- Helpers de Lógica de Negocio ---
+func roundToTwoDecimals(value float64) float64 {
+	return math.Round(value*100) / 100
 }
 
-func sumIngresos(ingresos []models.Income) float64 {
-	total := 0.0
+func sumIngresos(ingresos []models.Income) models.Money {
+	var total models.Money
 	for _, inc := range ingresos {
 		total += inc.Monto
 	}
 	return total
 }
 
-func sumGastos(gastos []models.Expense) float64 {
-	total := 0.0
+func sumGastos(gastos []models.Expense) models.Money {
+	var total models.Money
 	for _, exp := range gastos {
 		total += exp.Monto
 	}
@@ -126,19 +176,28 @@ func (s *reportService) CreateReport(ctx context.Context, userIDStr string, req
 		return nil, errors.New("invalid user ID")
 	}
 
-	churchEnabled, err := s.churchContributionsEnabled(ctx, userIDStr)
+	period, err := models.ParsePeriod(req.Month, req.Year)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPeriodAvailable(ctx, userObjID, period, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+	if err := normalizeItemDates(req.Ingresos, req.Gastos, period); err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.calcConfig(ctx, userIDStr)
 	if err != nil {
 		return nil, err
 	}
 
-	// Lógica de IDs y Redondeo
+	// IDs nuevos para los items (los importes ya llegan en centavos exactos)
 	for i := range req.Ingresos {
 		req.Ingresos[i].ID = primitive.NewObjectID()
-		req.Ingresos[i].Monto = roundToTwoDecimals(req.Ingresos[i].Monto)
 	}
 	for i := range req.Gastos {
 		req.Gastos[i].ID = primitive.NewObjectID()
-		req.Gastos[i].Monto = roundToTwoDecimals(req.Gastos[i].Monto)
 	}
 
 	tempReport := models.Report{
@@ -146,12 +205,12 @@ func (s *reportService) CreateReport(ctx context.Context, userIDStr string, req
 		Gastos:            req.Gastos,
 		PorcentajeOfrenda: req.PorcentajeOfrenda,
 	}
-	recalcReportTotalsWithChurch(&tempReport, churchEnabled)
+	recalcReportTotals(&tempReport, cfg)
 
 	finalReport := models.Report{
 		UserID:            userObjID,
-		Month:             req.Month,
-		Year:              req.Year,
+		Month:             period.MonthName(),
+		Year:              period.Year,
 		Ingresos:          req.Ingresos,
 		Gastos:            req.Gastos,
 		PorcentajeOfrenda: tempReport.PorcentajeOfrenda,
@@ -159,23 +218,38 @@ func (s *reportService) CreateReport(ctx context.Context, userIDStr string, req
 		Diezmos:           tempReport.Diezmos,
 		Ofrendas:          tempReport.Ofrendas,
 		Iglesia:           tempReport.Iglesia,
+		Contribuciones:    tempReport.Contribuciones,
+		Deducciones:       tempReport.Deducciones,
+		TotalDeducciones:  tempReport.TotalDeducciones,
 		IngresosNetos:     tempReport.IngresosNetos,
 		TotalGastos:       tempReport.TotalGastos,
 		Liquidacion:       tempReport.Liquidacion,
+		SaldoFinal:        tempReport.SaldoFinal,
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
 	}
 
-	res, err := s.repo.Create(ctx, finalReport)
+	// El alta y el reencadenado de los meses siguientes van en la misma transacción
+	finalReport.ID = primitive.NewObjectID()
+	var created models.Report
+	err = s.inTransaction(ctx, func(ctx context.Context) error {
+		created = finalReport
+		if _, err := s.repo.Create(ctx, created); err != nil {
+			return err
+		}
+		return s.propagateBalances(ctx, userObjID, cfg, periodIndex(&created), &created)
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, errDuplicatePeriod
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	finalReport.ID = res.InsertedID.(primitive.ObjectID)
-	return &finalReport, nil
+	return &created, nil
 }
 
-func (s *reportService) UpdateReport(ctx context.Context, reportID string, userIDStr string, req ReportRequest) (interface{}, error) {
+// UpdateReport sustituye el reporte completo solo si sigue en la versión que el cliente leyó.
+func (s *reportService) UpdateReport(ctx context.Context, reportID string, userIDStr string, version int64, req ReportRequest) (map[string]interface{}, error) {
 	oid, err := primitive.ObjectIDFromHex(reportID)
 	if err != nil {
 		return nil, errors.New("invalid report ID")
@@ -185,74 +259,136 @@ func (s *reportService) UpdateReport(ctx context.Context, reportID string, userI
 		return nil, errors.New("invalid user ID")
 	}
 
-	churchEnabled, err := s.churchContributionsEnabled(ctx, userIDStr)
+	period, err := models.ParsePeriod(req.Month, req.Year)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPeriodAvailable(ctx, userObjID, period, oid); err != nil {
+		return nil, err
+	}
+	if err := normalizeItemDates(req.Ingresos, req.Gastos, period); err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.calcConfig(ctx, userIDStr)
 	if err != nil {
 		return nil, err
 	}
 
-	// Lógica de redondeo y asignación de IDs si faltan
+	// Asignación de IDs si faltan
 	for i := range req.Ingresos {
 		if req.Ingresos[i].ID.IsZero() {
 			req.Ingresos[i].ID = primitive.NewObjectID()
 		}
-		req.Ingresos[i].Monto = roundToTwoDecimals(req.Ingresos[i].Monto)
 	}
 	for i := range req.Gastos {
 		if req.Gastos[i].ID.IsZero() {
 			req.Gastos[i].ID = primitive.NewObjectID()
 		}
-		req.Gastos[i].Monto = roundToTwoDecimals(req.Gastos[i].Monto)
 	}
 
-	if !churchEnabled {
-		existingRep, ferr := s.repo.FindOne(ctx, oid, userObjID)
-		if ferr != nil {
-			return nil, errors.New("not found")
+	// La edición y el reencadenado de los saldos van en la misma transacción
+	var tempReport models.Report
+	err = s.inTransaction(ctx, func(ctx context.Context) error {
+		existingRep, err := s.updateReportCAS(ctx, oid, userObjID, version, cfg, period, req, &tempReport)
+		if err != nil {
+			return err
 		}
-		req.PorcentajeOfrenda = existingRep.PorcentajeOfrenda
-	}
-
-	tempReport := models.Report{
-		Ingresos:          req.Ingresos,
-		Gastos:            req.Gastos,
-		PorcentajeOfrenda: req.PorcentajeOfrenda,
-	}
-	recalcReportTotalsWithChurch(&tempReport, churchEnabled)
-
-	update := bson.M{
-		"$set": bson.M{
-			"month":               req.Month,
-			"year":                req.Year,
-			"ingresos":            req.Ingresos,
-			"gastos":              req.Gastos,
-			"porcentaje_ofrenda":  roundToTwoDecimals(tempReport.PorcentajeOfrenda),
-			"total_ingreso_bruto": tempReport.TotalIngresoBruto,
-			"diezmos":             tempReport.Diezmos,
-			"ofrendas":            tempReport.Ofrendas,
-			"iglesia":             tempReport.Iglesia,
-			"ingresos_netos":      tempReport.IngresosNetos,
-			"total_gastos":        tempReport.TotalGastos,
-			"liquidacion":         tempReport.Liquidacion,
-			"updated_at":          time.Now(),
-		},
-	}
-
-	result, err := s.repo.Update(ctx, oid, userObjID, update)
+		// Un cambio de liquidación o de periodo mueve los saldos desde el primero de los dos meses
+		tempReport.ID = oid
+		tempReport.Month = period.MonthName()
+		tempReport.Year = period.Year
+		tempReport.Version = existingRep.Version + 1
+		from := periodIndex(existingRep)
+		if p := periodIndex(&tempReport); p < from {
+			from = p
+		}
+		return s.propagateBalances(ctx, userObjID, cfg, from, &tempReport)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if result.MatchedCount == 0 {
-		return nil, errors.New("not found")
-	}
 
 	// Retornamos datos para la respuesta
 	return map[string]interface{}{
 		"total_ingreso_bruto": tempReport.TotalIngresoBruto,
 		"liquidacion":         tempReport.Liquidacion,
+		"saldo_inicial":       tempReport.SaldoInicial,
+		"saldo_final":         tempReport.SaldoFinal,
 		"updated_at":          time.Now().Format(time.RFC3339),
+		"version":             tempReport.Version,
 	}, nil
 }
 
+// updateReportCAS es el bucle de lectura y compare-and-swap de UpdateReport; deja los totales
+// calculados en tempReport y devuelve el reporte tal como estaba antes de la edición.
+func (s *reportService) updateReportCAS(ctx context.Context, oid, userObjID primitive.ObjectID, version int64, cfg calcConfig, period models.Period, req ReportRequest, tempReport *models.Report) (*models.Report, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt == maxMutationAttempts {
+			return nil, errConcurrentUpdate
+		}
+		existingRep, err := s.repo.FindOne(ctx, oid, userObjID)
+		if err != nil {
+			return nil, errors.New("not found")
+		}
+		if version != AnyVersion && existingRep.Version != version {
+			return nil, errVersionMismatch
+		}
+		if existingRep.Cerrado {
+			return nil, errReportClosed
+		}
+		if !cfg.churchEnabled {
+			req.PorcentajeOfrenda = existingRep.PorcentajeOfrenda
+		}
+
+		*tempReport = models.Report{
+			Ingresos:          req.Ingresos,
+			Gastos:            req.Gastos,
+			PorcentajeOfrenda: req.PorcentajeOfrenda,
+			SaldoInicial:      existingRep.SaldoInicial,
+		}
+		recalcReportTotals(tempReport, cfg)
+
+		update := bson.M{
+			"$set": bson.M{
+				"month":               period.MonthName(),
+				"year":                period.Year,
+				"ingresos":            req.Ingresos,
+				"gastos":              req.Gastos,
+				"porcentaje_ofrenda":  roundToTwoDecimals(tempReport.PorcentajeOfrenda),
+				"total_ingreso_bruto": tempReport.TotalIngresoBruto,
+				"diezmos":             tempReport.Diezmos,
+				"ofrendas":            tempReport.Ofrendas,
+				"iglesia":             tempReport.Iglesia,
+				"contribuciones":      tempReport.Contribuciones,
+				"deducciones":         tempReport.Deducciones,
+				"total_deducciones":   tempReport.TotalDeducciones,
+				"ingresos_netos":      tempReport.IngresosNetos,
+				"total_gastos":        tempReport.TotalGastos,
+				"liquidacion":         tempReport.Liquidacion,
+				"saldo_final":         tempReport.SaldoFinal,
+				"updated_at":          time.Now(),
+			},
+		}
+
+		// Compare-and-swap sobre la versión leída: si otra escritura se adelantó, el cliente debe recargar.
+		// Con If-Match: * se vuelve a leer y reintentar (como en los items), para no pisar un cierre simultáneo.
+		result, err := s.repo.UpdateIfVersion(ctx, oid, userObjID, existingRep.Version, update)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errDuplicatePeriod
+		}
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 1 {
+			return existingRep, nil
+		}
+		if version != AnyVersion {
+			return nil, errVersionMismatch
+		}
+	}
+}
+
 func (s *reportService) GetReports(ctx context.Context, userIDStr string) ([]models.Report, error) {
 	userObjID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
@@ -278,7 +414,11 @@ func (s *reportService) GetReportsByMonth(ctx context.Context, userIDStr, month
 	if err != nil {
 		return nil, errors.New("invalid user ID")
 	}
-	return s.repo.FindByMonth(ctx, userObjID, month, year)
+	period, err := models.ParsePeriod(month, year)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindByMonth(ctx, userObjID, period.MonthName(), period.Year)
 }
 
 func (s *reportService) DeleteReport(ctx context.Context, reportID, userIDStr string) error {
@@ -291,124 +431,320 @@ func (s *reportService) DeleteReport(ctx context.Context, reportID, userIDStr st
 		return errors.New("invalid user ID")
 	}
 
-	res, err := s.repo.Delete(ctx, oid, userObjID)
+	cfg, err := s.calcConfig(ctx, userIDStr)
 	if err != nil {
 		return err
 	}
-	if res.DeletedCount == 0 {
-		return errors.New("not found")
+	// El borrado y el reencadenado de los meses siguientes van en la misma transacción
+	return s.inTransaction(ctx, func(ctx context.Context) error {
+		existing, err := s.repo.FindOne(ctx, oid, userObjID)
+		if err != nil {
+			return errors.New("not found")
+		}
+		if existing.Cerrado {
+			return errReportClosed
+		}
+		res, err := s.repo.DeleteIfOpen(ctx, oid, userObjID)
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return errors.New("not found")
+		}
+		return s.propagateBalances(ctx, userObjID, cfg, periodIndex(existing), nil)
+	})
+}
+
+// maxMutationAttempts: reintentos de mutateReport cuando otra escritura se adelanta.
+const maxMutationAttempts = 5
+
+// errConcurrentUpdate: el reporte cambió en cada uno de los reintentos.
+var errConcurrentUpdate = errors.New("el reporte se modificó al mismo tiempo, inténtalo de nuevo")
+
+// totalsSet son los campos calculados por recalcReportTotals, para un $set.
+func totalsSet(report *models.Report) bson.M {
+	return bson.M{
+		"porcentaje_ofrenda":  roundToTwoDecimals(report.PorcentajeOfrenda),
+		"total_ingreso_bruto": report.TotalIngresoBruto,
+		"diezmos":             report.Diezmos,
+		"ofrendas":            report.Ofrendas,
+		"iglesia":             report.Iglesia,
+		"contribuciones":      report.Contribuciones,
+		"deducciones":         report.Deducciones,
+		"total_deducciones":   report.TotalDeducciones,
+		"ingresos_netos":      report.IngresosNetos,
+		"total_gastos":        report.TotalGastos,
+		"liquidacion":         report.Liquidacion,
+		"saldo_final":         report.SaldoFinal,
+		"updated_at":          report.UpdatedAt,
 	}
-	return nil
 }
 
-func (s *reportService) AddIncome(ctx context.Context, reportID, userIDStr string, newIncome models.Income) (*models.Report, error) {
-	if newIncome.ID.IsZero() {
-		newIncome.ID = primitive.NewObjectID()
+// mutateReport aplica fn a la versión actual del reporte y la guarda solo si nadie lo modificó
+// entretanto (compare-and-swap sobre "version"); si otra escritura se adelanta, vuelve a leer y reintenta.
+// Así dos pestañas editando gastos a la vez no pierden ningún cambio (altas y bajas van por pushPullItem).
+// Con una versión concreta (If-Match) no se reintenta: si el reporte ya no está en esa versión, errVersionMismatch.
+func (s *reportService) mutateReport(ctx context.Context, reportID, userIDStr string, version int64, fn func(report *models.Report) error) (*models.Report, error) {
+	oid, err := primitive.ObjectIDFromHex(reportID)
+	if err != nil {
+		return nil, errors.New("invalid report ID")
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("invalid user ID")
 	}
 
-	churchEnabled, err := s.churchContributionsEnabled(ctx, userIDStr)
+	cfg, err := s.calcConfig(ctx, userIDStr)
 	if err != nil {
 		return nil, err
 	}
-
-	report, err := s.GetReportByID(ctx, reportID, userIDStr)
+	// La edición y el reencadenado de los saldos van en la misma transacción
+	var report *models.Report
+	err = s.inTransaction(ctx, func(ctx context.Context) error {
+		report, err = s.updateWithRetry(ctx, oid, userObjID, cfg, version, fn)
+		if err != nil {
+			return err
+		}
+		return s.propagateBalances(ctx, userObjID, cfg, periodIndex(report), report)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return report, nil
+}
 
-	report.Ingresos = append(report.Ingresos, newIncome)
-	recalcReportTotalsWithChurch(report, churchEnabled)
+// updateWithRetry es el bucle de mutateReport con los IDs ya validados.
+func (s *reportService) updateWithRetry(ctx context.Context, oid, userObjID primitive.ObjectID, cfg calcConfig, version int64, fn func(report *models.Report) error) (*models.Report, error) {
+	for attempt := 0; attempt < maxMutationAttempts; attempt++ {
+		report, err := s.repo.FindOne(ctx, oid, userObjID)
+		if err != nil {
+			return nil, err
+		}
+		if version != AnyVersion && report.Version != version {
+			return nil, errVersionMismatch
+		}
+		if report.Cerrado {
+			return nil, errReportClosed
+		}
+		if err := fn(report); err != nil {
+			return nil, err
+		}
+		recalcReportTotals(report, cfg)
 
-	userObjID, _ := primitive.ObjectIDFromHex(userIDStr)
-	_, err = s.repo.Update(ctx, report.ID, userObjID, bson.M{"$set": report})
-	return report, err
+		set := totalsSet(report)
+		set["ingresos"] = report.Ingresos
+		set["gastos"] = report.Gastos
+		res, err := s.repo.UpdateIfVersion(ctx, oid, userObjID, report.Version, bson.M{"$set": set})
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 1 {
+			report.Version++
+			return report, nil
+		}
+	}
+	return nil, errConcurrentUpdate
 }
 
-func (s *reportService) AddExpense(ctx context.Context, reportID, userIDStr string, newExpense models.Expense) (*models.Report, error) {
-	if newExpense.ID.IsZero() {
-		newExpense.ID = primitive.NewObjectID()
+// pushPullItem añade o quita un item con un $push/$pull sobre el documento, guarda los totales
+// recalculados sobre el resultado y reencadena los saldos, todo en una misma transacción: nadie ve
+// los items sin sus totales y, si algo falla, no queda el item guardado. Dos peticiones simultáneas chocan
+// (WriteConflict) y la transacción se repite sobre el documento ya actualizado, así que no se pierde
+// ningún item aunque no haya If-Match. prepare recibe el reporte leído (para validar contra su
+// periodo) y devuelve la condición extra del filtro y el update.
+func (s *reportService) pushPullItem(ctx context.Context, reportID, userIDStr string, version int64, prepare func(report *models.Report) (bson.M, bson.M, error)) (*models.Report, error) {
+	oid, err := primitive.ObjectIDFromHex(reportID)
+	if err != nil {
+		return nil, errors.New("invalid report ID")
 	}
-
-	churchEnabled, err := s.churchContributionsEnabled(ctx, userIDStr)
+	userObjID, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("invalid user ID")
 	}
-
-	report, err := s.GetReportByID(ctx, reportID, userIDStr)
+	cfg, err := s.calcConfig(ctx, userIDStr)
 	if err != nil {
 		return nil, err
 	}
 
-	report.Gastos = append(report.Gastos, newExpense)
-	recalcReportTotalsWithChurch(report, churchEnabled)
+	var report *models.Report
+	err = s.inTransaction(ctx, func(ctx context.Context) error {
+		current, err := s.repo.FindOne(ctx, oid, userObjID)
+		if err != nil {
+			return err
+		}
+		if version != AnyVersion && current.Version != version {
+			return errVersionMismatch
+		}
+		if current.Cerrado {
+			return errReportClosed
+		}
+		cond, update, err := prepare(current)
+		if err != nil {
+			return err
+		}
+		cond["cerrado"] = bson.M{"$ne": true}
+		update["$set"] = bson.M{"updated_at": time.Now()}
 
-	userObjID, _ := primitive.ObjectIDFromHex(userIDStr)
-	_, err = s.repo.Update(ctx, report.ID, userObjID, bson.M{"$set": report})
-	return report, err
-}
+		updated, err := s.repo.UpdateAndFetch(ctx, oid, userObjID, current.Version, cond, update)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return errConcurrentUpdate
+		}
+		if err != nil {
+			return err
+		}
 
-func (s *reportService) RemoveIncome(ctx context.Context, reportID, userIDStr, incomeID string) (*models.Report, error) {
-	churchEnabled, err := s.churchContributionsEnabled(ctx, userIDStr)
+		// Totales sobre los items resultantes, en la misma transacción (sin otro incremento de versión)
+		recalcReportTotals(updated, cfg)
+		if _, err := s.repo.Update(ctx, oid, userObjID, bson.M{"$set": totalsSet(updated)}); err != nil {
+			return err
+		}
+		report = updated
+		return s.propagateBalances(ctx, userObjID, cfg, periodIndex(report), report)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return report, nil
+}
 
-	report, err := s.GetReportByID(ctx, reportID, userIDStr)
+// inTransaction ejecuta fn en una transacción. WithTransaction la repite si choca con otra escritura
+// simultánea (WriteConflict), así que fn debe poder ejecutarse más de una vez.
+func (s *reportService) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := s.client.StartSession()
 	if err != nil {
-		return nil, err
+		return errors.New("error al iniciar sesión de DB")
 	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionContext)
+	})
+	return err
+}
 
-	var updatedIncomes []models.Income
-	found := false
-	for _, inc := range report.Ingresos {
-		if inc.ID.Hex() != incomeID {
-			updatedIncomes = append(updatedIncomes, inc)
-		} else {
-			found = true
-		}
+func (s *reportService) AddIncome(ctx context.Context, reportID, userIDStr string, version int64, newIncome models.Income) (*models.Report, error) {
+	if newIncome.ID.IsZero() {
+		newIncome.ID = primitive.NewObjectID()
 	}
-	if !found {
-		return nil, errors.New("income not found")
+
+	return s.pushPullItem(ctx, reportID, userIDStr, version, func(report *models.Report) (bson.M, bson.M, error) {
+		period, err := reportPeriod(report)
+		if err != nil {
+			return nil, nil, err
+		}
+		item := newIncome
+		if err := item.ItemDate.Normalize(period); err != nil {
+			return nil, nil, err
+		}
+		return bson.M{}, bson.M{"$push": bson.M{"ingresos": item}}, nil
+	})
+}
+
+func (s *reportService) AddExpense(ctx context.Context, reportID, userIDStr string, version int64, newExpense models.Expense) (*models.Report, error) {
+	if newExpense.ID.IsZero() {
+		newExpense.ID = primitive.NewObjectID()
 	}
 
-	report.Ingresos = updatedIncomes
-	recalcReportTotalsWithChurch(report, churchEnabled)
+	return s.pushPullItem(ctx, reportID, userIDStr, version, func(report *models.Report) (bson.M, bson.M, error) {
+		period, err := reportPeriod(report)
+		if err != nil {
+			return nil, nil, err
+		}
+		item := newExpense
+		if err := item.ItemDate.Normalize(period); err != nil {
+			return nil, nil, err
+		}
+		return bson.M{}, bson.M{"$push": bson.M{"gastos": item}}, nil
+	})
+}
+
+func (s *reportService) RemoveIncome(ctx context.Context, reportID, userIDStr string, version int64, incomeID string) (*models.Report, error) {
+	return s.pushPullItem(ctx, reportID, userIDStr, version, func(report *models.Report) (bson.M, bson.M, error) {
+		for _, inc := range report.Ingresos {
+			if inc.ID.Hex() == incomeID {
+				return bson.M{"ingresos._id": inc.ID}, bson.M{"$pull": bson.M{"ingresos": bson.M{"_id": inc.ID}}}, nil
+			}
+		}
+		return nil, nil, errors.New("income not found")
+	})
+}
 
-	userObjID, _ := primitive.ObjectIDFromHex(userIDStr)
-	_, err = s.repo.Update(ctx, report.ID, userObjID, bson.M{"$set": report})
-	return report, err
+func (s *reportService) RemoveExpense(ctx context.Context, reportID, userIDStr string, version int64, expenseID string) (*models.Report, error) {
+	return s.pushPullItem(ctx, reportID, userIDStr, version, func(report *models.Report) (bson.M, bson.M, error) {
+		for _, exp := range report.Gastos {
+			if exp.ID.Hex() == expenseID {
+				return bson.M{"gastos._id": exp.ID}, bson.M{"$pull": bson.M{"gastos": bson.M{"_id": exp.ID}}}, nil
+			}
+		}
+		return nil, nil, errors.New("expense not found")
+	})
 }
 
-func (s *reportService) RemoveExpense(ctx context.Context, reportID, userIDStr, expenseID string) (*models.Report, error) {
-	churchEnabled, err := s.churchContributionsEnabled(ctx, userIDStr)
-	if err != nil {
-		return nil, err
-	}
+// errEmptyPatch: el PATCH no trae ningún campo editable.
+var errEmptyPatch = errors.New("no hay campos para actualizar")
 
-	report, err := s.GetReportByID(ctx, reportID, userIDStr)
-	if err != nil {
-		return nil, err
+// applyItemPatch copia al item los campos presentes en el patch y revalida la fecha contra el periodo.
+func applyItemPatch(concepto *string, monto *models.Money, categoriaID **primitive.ObjectID, date *models.ItemDate, patch ItemPatch, period models.Period) error {
+	if patch.Concepto != nil {
+		*concepto = *patch.Concepto
 	}
-
-	var updatedExpenses []models.Expense
-	found := false
-	for _, exp := range report.Gastos {
-		if exp.ID.Hex() != expenseID {
-			updatedExpenses = append(updatedExpenses, exp)
-		} else {
-			found = true
+	if patch.Monto != nil {
+		*monto = *patch.Monto
+	}
+	if patch.CategoriaID.Set {
+		*categoriaID = patch.CategoriaID.Value
+	}
+	if patch.FechaHora.Set {
+		date.FechaHora = patch.FechaHora.Value
+		if patch.Fecha == nil {
+			// La fecha se vuelve a derivar del nuevo instante
+			date.Fecha = ""
 		}
 	}
-	if !found {
-		return nil, errors.New("expense not found")
+	if patch.Fecha != nil {
+		date.Fecha = *patch.Fecha
 	}
+	if patch.ZonaHoraria != nil {
+		date.ZonaHoraria = *patch.ZonaHoraria
+	}
+	return date.Normalize(period)
+}
 
-	report.Gastos = updatedExpenses
-	recalcReportTotalsWithChurch(report, churchEnabled)
+func (s *reportService) UpdateIncome(ctx context.Context, reportID, userIDStr string, version int64, incomeID string, patch ItemPatch) (*models.Report, error) {
+	if patch.empty() {
+		return nil, errEmptyPatch
+	}
+	return s.mutateReport(ctx, reportID, userIDStr, version, func(report *models.Report) error {
+		period, err := reportPeriod(report)
+		if err != nil {
+			return err
+		}
+		for i := range report.Ingresos {
+			inc := &report.Ingresos[i]
+			if inc.ID.Hex() == incomeID {
+				return applyItemPatch(&inc.Concepto, &inc.Monto, &inc.CategoriaID, &inc.ItemDate, patch, period)
+			}
+		}
+		return errors.New("income not found")
+	})
+}
 
-	userObjID, _ := primitive.ObjectIDFromHex(userIDStr)
-	_, err = s.repo.Update(ctx, report.ID, userObjID, bson.M{"$set": report})
-	return report, err
+func (s *reportService) UpdateExpense(ctx context.Context, reportID, userIDStr string, version int64, expenseID string, patch ItemPatch) (*models.Report, error) {
+	if patch.empty() {
+		return nil, errEmptyPatch
+	}
+	return s.mutateReport(ctx, reportID, userIDStr, version, func(report *models.Report) error {
+		period, err := reportPeriod(report)
+		if err != nil {
+			return err
+		}
+		for i := range report.Gastos {
+			exp := &report.Gastos[i]
+			if exp.ID.Hex() == expenseID {
+				return applyItemPatch(&exp.Concepto, &exp.Monto, &exp.CategoriaID, &exp.ItemDate, patch, period)
+			}
+		}
+		return errors.New("expense not found")
+	})
 }
 
 // GetAnnualReport: Filtra por Usuario + Año
@@ -426,9 +762,7 @@ func (s *reportService) GetAnnualReport(ctx context.Context, userIDStr string, y
 		}},
 	}
 
-	pipeline := append(mongo.Pipeline{matchStage}, s.getFinancialAnalysisPipeline()...)
-
-	return s.executeAggregation(ctx, pipeline)
+	return s.executeAggregation(ctx, matchStage)
 }
 
 // GetGeneralBalance: Filtra solo por Usuario (Histórico completo)
@@ -445,9 +779,7 @@ func (s *reportService) GetGeneralBalance(ctx context.Context, userIDStr string)
 		}},
 	}
 
-	pipeline := append(mongo.Pipeline{matchStage}, s.getFinancialAnalysisPipeline()...)
-
-	return s.executeAggregation(ctx, pipeline)
+	return s.executeAggregation(ctx, matchStage)
 }
 
 // Devuelve los pasos comunes ($group y $project) que comparten tanto el reporte anual como el general.
@@ -460,6 +792,7 @@ func (s *reportService) getFinancialAnalysisPipeline() mongo.Pipeline {
 			{Key: "total_diezmos", Value: bson.D{{Key: "$sum", Value: "$diezmos"}}},
 			{Key: "total_ofrendas", Value: bson.D{{Key: "$sum", Value: "$ofrendas"}}},
 			{Key: "total_iglesia", Value: bson.D{{Key: "$sum", Value: "$iglesia"}}},
+			{Key: "total_deducciones", Value: bson.D{{Key: "$sum", Value: "$total_deducciones"}}},
 			{Key: "total_gastos", Value: bson.D{{Key: "$sum", Value: "$total_gastos"}}},
 			{Key: "liquidacion_final", Value: bson.D{{Key: "$sum", Value: "$liquidacion"}}},
 		}}},
@@ -470,79 +803,127 @@ func (s *reportService) getFinancialAnalysisPipeline() mongo.Pipeline {
 			{Key: "total_diezmos", Value: 1},
 			{Key: "total_ofrendas", Value: 1},
 			{Key: "total_iglesia", Value: 1},
+			{Key: "total_deducciones", Value: 1},
 			{Key: "total_gastos", Value: 1},
 			{Key: "liquidacion_final", Value: 1},
 		}}},
 	}
 }
 
-// executeAggregation ejecuta el pipeline en el repositorio y formatea/redondea el resultado
-func (s *reportService) executeAggregation(ctx context.Context, pipeline mongo.Pipeline) (bson.M, error) {
+// getDeductionsPipeline suma el desglose de deducciones de los reportes por regla.
+func (s *reportService) getDeductionsPipeline() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$unwind", Value: "$deducciones"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$deducciones.rule_id"},
+			{Key: "name", Value: bson.D{{Key: "$last", Value: "$deducciones.name"}}},
+			{Key: "type", Value: bson.D{{Key: "$last", Value: "$deducciones.type"}}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$deducciones.monto"}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "total", Value: -1}}}},
+	}
+}
+
+// executeAggregation ejecuta el análisis sobre los reportes que pasan matchStage y formatea el resultado.
+func (s *reportService) executeAggregation(ctx context.Context, matchStage bson.D) (bson.M, error) {
 	// Llamamos al repositorio
-	results, err := s.repo.AggregateReports(ctx, pipeline)
+	results, err := s.repo.AggregateReports(ctx, append(mongo.Pipeline{matchStage}, s.getFinancialAnalysisPipeline()...))
 	if err != nil {
 		return nil, err
 	}
 
 	// Si no hay datos (ej: usuario nuevo sin reportes) devolvemos todo en 0
-	if len(results) == 0 {
-		return bson.M{
-			"total_ingreso_bruto": 0.0,
-			"total_ingreso_neto":  0.0,
-			"total_diezmos":       0.0,
-			"total_ofrendas":      0.0,
-			"total_iglesia":       0.0,
-			"total_gastos":        0.0,
-			"liquidacion_final":   0.0,
-		}, nil
-	}
-
-	result := results[0]
-
-	// Aplicar redondeo a los resultados
-	fields := []string{"total_ingreso_bruto", "total_ingreso_neto", "total_diezmos", "total_ofrendas", "total_iglesia", "total_gastos", "liquidacion_final"}
+	result := bson.M{}
+	if len(results) > 0 {
+		result = results[0]
+	}
+
+	// $sum sobre centavos int64 es exacto; se devuelven como Money para que el JSON siga siendo decimal
+	fields := []string{"total_ingreso_bruto", "total_ingreso_neto", "total_diezmos", "total_ofrendas", "total_iglesia", "total_deducciones", "total_gastos", "liquidacion_final"}
 	for _, f := range fields {
-		if val, ok := result[f].(float64); ok {
-			result[f] = s.roundToTwoDecimals(val)
-		} else {
-			// Asegurar que si viene nulo o entero, se ponga como 0.0
-			result[f] = 0.0
+		if result[f], err = moneyFromSum(result[f]); err != nil {
+			return nil, err
 		}
 	}
+
+	// Totales por regla (impuestos, ahorro, diezmo...), en lugar de solo total_diezmos/total_ofrendas
+	rules, err := s.repo.AggregateReports(ctx, append(mongo.Pipeline{matchStage}, s.getDeductionsPipeline()...))
+	if err != nil {
+		return nil, err
+	}
+	deducciones := make([]bson.M, 0, len(rules))
+	for _, r := range rules {
+		total, err := moneyFromSum(r["total"])
+		if err != nil {
+			return nil, err
+		}
+		deducciones = append(deducciones, bson.M{
+			"rule_id": r["_id"],
+			"name":    r["name"],
+			"type":    r["type"],
+			"total":   total,
+		})
+	}
+	result["deducciones"] = deducciones
 	return result, nil
 }
 
-func (s *reportService) RecalculateAllReportsForUser(ctx context.Context, userIDStr string, churchEnabled bool) error {
+// moneyFromSum convierte el resultado de un $sum sobre centavos en Money (0 si es nulo). Mongo
+// devuelve double si la suma desborda int64 o incluye algún double, y Decimal128 si incluye alguno:
+// se redondean al centavo. Cualquier otro tipo es un error, no un 0 silencioso.
+func moneyFromSum(v interface{}) (models.Money, error) {
+	var cents float64
+	switch val := v.(type) {
+	case nil:
+		// Sin reportes
+		return 0, nil
+	case int64:
+		return models.Money(val), nil
+	case int32:
+		return models.Money(val), nil
+	case float64:
+		cents = val
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(val.String(), 64)
+		if err != nil {
+			return 0, fmt.Errorf("suma de importes inválida: %v", val)
+		}
+		cents = f
+	default:
+		return 0, fmt.Errorf("suma de importes de tipo inesperado %T", v)
+	}
+	if math.IsNaN(cents) || math.IsInf(cents, 0) || math.Abs(cents) >= math.MaxInt64 {
+		return 0, fmt.Errorf("suma de importes fuera de rango: %v", v)
+	}
+	return models.Money(math.Round(cents)), nil
+}
+
+func (s *reportService) RecalculateAllReportsForUser(ctx context.Context, userIDStr string) error {
 	oid, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
 		return errors.New("invalid user ID")
 	}
-	reports, err := s.repo.FindAll(ctx, oid)
+	cfg, err := s.calcConfig(ctx, userIDStr)
 	if err != nil {
 		return err
 	}
-	for i := range reports {
-		rep := &reports[i]
-		recalcReportTotalsWithChurch(rep, churchEnabled)
-		_, err := s.repo.Update(ctx, rep.ID, oid, bson.M{"$set": bson.M{
-			"porcentaje_ofrenda":  roundToTwoDecimals(rep.PorcentajeOfrenda),
-			"total_ingreso_bruto": rep.TotalIngresoBruto,
-			"diezmos":             rep.Diezmos,
-			"ofrendas":            rep.Ofrendas,
-			"iglesia":             rep.Iglesia,
-			"ingresos_netos":      rep.IngresosNetos,
-			"total_gastos":        rep.TotalGastos,
-			"liquidacion":         rep.Liquidacion,
-			"updated_at":          rep.UpdatedAt,
-		}})
+	noChange := func(*models.Report) error { return nil }
+	return s.inTransaction(ctx, func(ctx context.Context) error {
+		reports, err := s.repo.FindAll(ctx, oid)
 		if err != nil {
 			return err
 		}
-	}
-	return nil
-}
-
-// roundToTwoDecimals helper (si no lo tienes en utils, déjalo aquí)
-func (s *reportService) roundToTwoDecimals(val float64) float64 {
-	return math.Round(val*100) / 100
+		for _, rep := range reports {
+			if rep.Cerrado {
+				// Los meses cerrados conservan las cifras con las que se conciliaron
+				continue
+			}
+			if _, err := s.updateWithRetry(ctx, rep.ID, oid, cfg, AnyVersion, noChange); err != nil {
+				return err
+			}
+		}
+		// También reencadena (o pone a 0) los saldos iniciales si cambió enable_carry_over
+		_, err = refreshBalances(ctx, s.repo, oid, cfg.carryOver, allPeriods)
+		return err
+	})
 }
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/JimcostDev/finances-api/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDB abre una base de datos desechable en MONGO_TEST_URI; sin la variable el test se salta.
+func testDB(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI no está definida")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database("finances_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = db.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	return db
+}
+
+// newTestReport crea un usuario sin aportes a la iglesia y un reporte vacío de enero de 2026.
+func newTestReport(t *testing.T) (ReportService, repositories.ReportRepository, primitive.ObjectID, *models.Report) {
+	t.Helper()
+	db := testDB(t)
+	ctx := context.Background()
+
+	userRepo := repositories.NewUserRepository(db)
+	reportRepo := repositories.NewReportRepository(db)
+	svc := NewReportService(reportRepo, userRepo, db.Client())
+
+	userID := primitive.NewObjectID()
+	if _, err := userRepo.Create(ctx, models.User{ID: userID, Email: "concurrencia@example.com", Username: "concurrencia"}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := svc.CreateReport(ctx, userID.Hex(), ReportRequest{Month: "Enero", Year: 2026})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, reportRepo, userID, report
+}
+
+// storedReport lee el reporte guardado y comprueba que sus totales son los que salen de recalcularlos
+// sobre sus propios items.
+func storedReport(t *testing.T, svc ReportService, reportRepo repositories.ReportRepository, userID primitive.ObjectID, reportID primitive.ObjectID) *models.Report {
+	t.Helper()
+	ctx := context.Background()
+	got, err := reportRepo.FindOne(ctx, reportID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := svc.(*reportService).calcConfig(ctx, userID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := *got
+	recalcReportTotals(&want, cfg)
+	stored, recomputed := totalsSet(got), totalsSet(&want)
+	delete(stored, "updated_at")
+	delete(recomputed, "updated_at")
+	if !reflect.DeepEqual(stored, recomputed) {
+		t.Errorf("totales guardados %v, recalculados sobre los items %v", stored, recomputed)
+	}
+	return got
+}
+
+// seedItems añade n ingresos y n gastos y devuelve sus IDs.
+func seedItems(t *testing.T, svc ReportService, userID primitive.ObjectID, reportID string, n int) (incomeIDs, expenseIDs []string) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		r, err := svc.AddIncome(ctx, reportID, userID.Hex(), AnyVersion, models.Income{Concepto: fmt.Sprintf("ingreso %d", i), Monto: models.Money(100 * (i + 1))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		incomeIDs = append(incomeIDs, r.Ingresos[len(r.Ingresos)-1].ID.Hex())
+		r, err = svc.AddExpense(ctx, reportID, userID.Hex(), AnyVersion, models.Expense{Concepto: fmt.Sprintf("gasto %d", i), Monto: models.Money(10 * (i + 1))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expenseIDs = append(expenseIDs, r.Gastos[len(r.Gastos)-1].ID.Hex())
+	}
+	return incomeIDs, expenseIDs
+}
+
+// Altas simultáneas de ingresos y gastos en el mismo reporte, sin If-Match: no se pierde ninguna
+// y los totales guardados cuadran con los items.
+func TestConcurrentItemAdds(t *testing.T) {
+	svc, reportRepo, userID, report := newTestReport(t)
+	ctx := context.Background()
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	var wantIngresos, wantGastos models.Money
+	for i := 0; i < n; i++ {
+		income := models.Income{Concepto: fmt.Sprintf("ingreso %d", i), Monto: models.Money(100 * (i + 1))}
+		expense := models.Expense{Concepto: fmt.Sprintf("gasto %d", i), Monto: models.Money(10 * (i + 1))}
+		wantIngresos += income.Monto
+		wantGastos += expense.Monto
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.AddIncome(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, income); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := svc.AddExpense(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, expense); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("alta concurrente: %v", err)
+	}
+
+	got := storedReport(t, svc, reportRepo, userID, report.ID)
+	if len(got.Ingresos) != n || len(got.Gastos) != n {
+		t.Fatalf("items guardados: %d ingresos y %d gastos, se esperaban %d de cada", len(got.Ingresos), len(got.Gastos), n)
+	}
+	if got.TotalIngresoBruto != wantIngresos {
+		t.Errorf("total_ingreso_bruto = %v, se esperaba %v", got.TotalIngresoBruto, wantIngresos)
+	}
+	if got.TotalGastos != wantGastos {
+		t.Errorf("total_gastos = %v, se esperaba %v", got.TotalGastos, wantGastos)
+	}
+	if got.Liquidacion != wantIngresos-wantGastos {
+		t.Errorf("liquidacion = %v, se esperaba %v", got.Liquidacion, wantIngresos-wantGastos)
+	}
+}
+
+// Bajas simultáneas de todos los ingresos y gastos: el reporte queda vacío y con los totales a cero.
+func TestConcurrentItemRemoves(t *testing.T) {
+	svc, reportRepo, userID, report := newTestReport(t)
+	ctx := context.Background()
+
+	const n = 10
+	incomeIDs, expenseIDs := seedItems(t, svc, userID, report.ID.Hex(), n)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		incomeID, expenseID := incomeIDs[i], expenseIDs[i]
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.RemoveIncome(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, incomeID); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := svc.RemoveExpense(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, expenseID); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("baja concurrente: %v", err)
+	}
+
+	got := storedReport(t, svc, reportRepo, userID, report.ID)
+	if len(got.Ingresos) != 0 || len(got.Gastos) != 0 {
+		t.Fatalf("quedan %d ingresos y %d gastos, se esperaba ninguno", len(got.Ingresos), len(got.Gastos))
+	}
+	if got.TotalIngresoBruto != 0 || got.TotalGastos != 0 || got.Liquidacion != 0 {
+		t.Errorf("totales = %v/%v/%v, se esperaban a cero", got.TotalIngresoBruto, got.TotalGastos, got.Liquidacion)
+	}
+}
+
+// Altas y bajas mezcladas: quedan exactamente los items nuevos y los totales cuadran.
+func TestConcurrentItemAddsAndRemoves(t *testing.T) {
+	svc, reportRepo, userID, report := newTestReport(t)
+	ctx := context.Background()
+
+	const n = 10
+	incomeIDs, expenseIDs := seedItems(t, svc, userID, report.ID.Hex(), n)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*n)
+	for i := 0; i < n; i++ {
+		incomeID, expenseID := incomeIDs[i], expenseIDs[i]
+		income := models.Income{Concepto: fmt.Sprintf("nuevo ingreso %d", i), Monto: 1000}
+		expense := models.Expense{Concepto: fmt.Sprintf("nuevo gasto %d", i), Monto: 100}
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.RemoveIncome(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, incomeID); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := svc.RemoveExpense(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, expenseID); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := svc.AddIncome(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, income); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := svc.AddExpense(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, expense); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("alta/baja concurrente: %v", err)
+	}
+
+	got := storedReport(t, svc, reportRepo, userID, report.ID)
+	if len(got.Ingresos) != n || len(got.Gastos) != n {
+		t.Fatalf("items guardados: %d ingresos y %d gastos, se esperaban %d de cada", len(got.Ingresos), len(got.Gastos), n)
+	}
+	if got.TotalIngresoBruto != 1000*n || got.TotalGastos != 100*n {
+		t.Errorf("totales = %v/%v, se esperaban %v/%v", got.TotalIngresoBruto, got.TotalGastos, models.Money(1000*n), models.Money(100*n))
+	}
+}
+
+// Un cierre en medio de las altas: las que llegan después fallan, pero el reporte cerrado conserva
+// totales que cuadran con los items que sí entraron.
+func TestCloseDuringItemAdds(t *testing.T) {
+	svc, reportRepo, userID, report := newTestReport(t)
+	ctx := context.Background()
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n+1)
+	for i := 0; i < n; i++ {
+		income := models.Income{Concepto: fmt.Sprintf("ingreso %d", i), Monto: models.Money(100 * (i + 1))}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.AddIncome(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, income)
+			if err != nil && err != errReportClosed && err != errConcurrentUpdate {
+				errs <- err
+			}
+		}()
+		if i == n/2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					_, err := svc.CloseReport(ctx, report.ID.Hex(), userID.Hex(), AnyVersion, "")
+					if err != errConcurrentUpdate {
+						if err != nil {
+							errs <- err
+						}
+						return
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("alta o cierre concurrente: %v", err)
+	}
+
+	got := storedReport(t, svc, reportRepo, userID, report.ID)
+	if !got.Cerrado {
+		t.Fatal("el reporte no quedó cerrado")
+	}
+}
@@ -0,0 +1,22 @@
+package services
+
+import "context"
+
+// RequestMeta son los datos del cliente HTTP que los servicios registran (sesiones, auditoría).
+type RequestMeta struct {
+	IP        string
+	UserAgent string
+}
+
+type requestMetaKey struct{}
+
+// WithRequestMeta adjunta los datos del cliente al contexto que reciben los servicios.
+func WithRequestMeta(ctx context.Context, meta RequestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaKey{}, meta)
+}
+
+// requestMetaFrom devuelve los datos del cliente del contexto (vacíos si no se adjuntaron).
+func requestMetaFrom(ctx context.Context) RequestMeta {
+	meta, _ := ctx.Value(requestMetaKey{}).(RequestMeta)
+	return meta
+}
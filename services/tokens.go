@@ -0,0 +1,61 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/JimcostDev/finances-api/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// accessTokenTTL: vida del JWT de acceso (ACCESS_TOKEN_TTL_MINUTES, 15 min por defecto).
+func accessTokenTTL() time.Duration {
+	return time.Duration(config.EnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+}
+
+// refreshTokenTTL: vida del refresh token / sesión (REFRESH_TOKEN_TTL_DAYS, 30 días por defecto).
+func refreshTokenTTL() time.Duration {
+	return time.Duration(config.EnvInt("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour
+}
+
+// generateOpaqueToken devuelve un secreto aleatorio de 32 bytes en base64url.
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken: los tokens opacos se guardan como SHA-256 (tienen entropía suficiente, no hace falta bcrypt).
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken genera "<sessionID>.<secreto>": el prefijo permite localizar la sesión sin buscar por hash.
+func newRefreshToken(sessionID primitive.ObjectID) (token string, hash string, err error) {
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID.Hex() + "." + secret, hashToken(secret), nil
+}
+
+// parseRefreshToken separa el ID de sesión y el secreto de un refresh token.
+func parseRefreshToken(token string) (primitive.ObjectID, string, error) {
+	sessionHex, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return primitive.NilObjectID, "", errors.New("sesión inválida o expirada")
+	}
+	oid, err := primitive.ObjectIDFromHex(sessionHex)
+	if err != nil {
+		return primitive.NilObjectID, "", errors.New("sesión inválida o expirada")
+	}
+	return oid, secret, nil
+}
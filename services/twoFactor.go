@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/JimcostDev/finances-api/models"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mfaTokenTTL: tiempo para introducir el código tras validar la contraseña.
+const mfaTokenTTL = 5 * time.Minute
+
+// maxMFAAttempts: códigos fallidos tras los que el token "mfa pending" deja de valer.
+const maxMFAAttempts = 5
+
+var errInvalidMFAToken = errors.New("token de verificación inválido o expirado")
+
+const recoveryCodeCount = 10
+
+// TwoFactorSetup es lo que el cliente necesita para registrar la cuenta en la app TOTP.
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFALoginRequest es el segundo paso del login: token "mfa pending" + código TOTP o de recuperación.
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// signMFAToken emite el token corto que prueba que la contraseña ya fue validada.
+// No lleva "sid", así que Authenticate nunca lo acepta como access token. Su "jti" se guarda
+// en user_tokens: se consume al completar el login o tras maxMFAAttempts códigos fallidos.
+func (s *authService) signMFAToken(ctx context.Context, user *models.User) (string, error) {
+	jti, err := generateOpaqueToken()
+	if err != nil {
+		return "", errors.New("no se pudo generar el token")
+	}
+	now := time.Now()
+	expiresAt := now.Add(mfaTokenTTL)
+	_, err = s.userTokens.Create(ctx, models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeMFALogin,
+		TokenHash: hashToken(jti),
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.keys.sign(jwt.MapClaims{
+		"id":  user.ID.Hex(),
+		"typ": "mfa",
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
+	})
+}
+
+// generateRecoveryCodes devuelve códigos "xxxxx-xxxxx" en claro y sus hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func (s *authService) findUser(ctx context.Context, userIDStr string) (*models.User, error) {
+	oid, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return nil, errors.New("ID inválido")
+	}
+	user, err := s.repo.FindByID(ctx, oid)
+	if err != nil {
+		return nil, errors.New("usuario no encontrado")
+	}
+	return user, nil
+}
+
+// verifySecondFactor acepta un código TOTP (una sola vez por paso de 30 s) o consume un código de recuperación.
+func (s *authService) verifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) error {
+	if code != "" {
+		step, ok := validateTOTP(user.TwoFactorSecret, code, time.Now())
+		if !ok {
+			return errors.New("código de verificación inválido")
+		}
+		// $max solo modifica si el paso es posterior al último usado: un código no se puede reutilizar
+		res, err := s.repo.Update(ctx, user.ID, bson.M{"$max": bson.M{"two_factor_last_step": step}})
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			return errors.New("código de verificación inválido")
+		}
+		return nil
+	}
+
+	if recoveryCode != "" {
+		hash := hashToken(normalizeRecoveryCode(recoveryCode))
+		res, err := s.repo.Update(ctx, user.ID, bson.M{"$pull": bson.M{"recovery_code_hashes": hash}})
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			return errors.New("código de verificación inválido")
+		}
+		return nil
+	}
+
+	return errors.New("código de verificación inválido")
+}
+
+// SetupTwoFactor genera un secreto pendiente; no se activa hasta confirmar un primer código.
+func (s *authService) SetupTwoFactor(ctx context.Context, userIDStr string) (*TwoFactorSetup, error) {
+	user, err := s.findUser(ctx, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, errors.New("la verificación en dos pasos ya está activada")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, errors.New("no se pudo generar el secreto")
+	}
+	_, err = s.repo.Update(ctx, user.ID, bson.M{"$set": bson.M{
+		"two_factor_pending_secret": secret,
+		"updated_at":                time.Now(),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorSetup{Secret: secret, OTPAuthURL: totpURI(secret, user.Email)}, nil
+}
+
+// EnableTwoFactor activa 2FA si el código corresponde al secreto pendiente y devuelve los códigos de recuperación.
+func (s *authService) EnableTwoFactor(ctx context.Context, userIDStr string, req TwoFactorCodeRequest) ([]string, error) {
+	user, err := s.findUser(ctx, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, errors.New("la verificación en dos pasos ya está activada")
+	}
+	if user.TwoFactorPendingSecret == "" {
+		return nil, errors.New("no hay una configuración de dos pasos pendiente")
+	}
+
+	step, ok := validateTOTP(user.TwoFactorPendingSecret, req.Code, time.Now())
+	if !ok {
+		return nil, errors.New("código de verificación inválido")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, errors.New("no se pudieron generar los códigos de recuperación")
+	}
+	_, err = s.repo.Update(ctx, user.ID, bson.M{
+		"$set": bson.M{
+			"two_factor_enabled":   true,
+			"two_factor_secret":    user.TwoFactorPendingSecret,
+			"two_factor_last_step": step,
+			"recovery_code_hashes": hashes,
+			"updated_at":           time.Now(),
+		},
+		"$unset": bson.M{"two_factor_pending_secret": ""},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, user.ID, models.AuditTwoFactorEnabled, nil)
+	return codes, nil
+}
+
+// DisableTwoFactor exige la contraseña y un segundo factor válido.
+func (s *authService) DisableTwoFactor(ctx context.Context, userIDStr string, req DisableTwoFactorRequest) error {
+	user, err := s.findUser(ctx, userIDStr)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return errors.New("la verificación en dos pasos no está activada")
+	}
+	if ok, _ := verifyPassword(user.Password, req.Password); !ok {
+		return errors.New("credenciales inválidas")
+	}
+	if err := s.verifySecondFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		return err
+	}
+
+	_, err = s.repo.Update(ctx, user.ID, bson.M{
+		"$set": bson.M{"two_factor_enabled": false, "updated_at": time.Now()},
+		"$unset": bson.M{
+			"two_factor_secret":    "",
+			"two_factor_last_step": "",
+			"recovery_code_hashes": "",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user.ID, models.AuditTwoFactorDisabled, nil)
+	return nil
+}
+
+// RegenerateRecoveryCodes sustituye todos los códigos de recuperación (los anteriores dejan de valer).
+func (s *authService) RegenerateRecoveryCodes(ctx context.Context, userIDStr string, req TwoFactorCodeRequest) ([]string, error) {
+	user, err := s.findUser(ctx, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled {
+		return nil, errors.New("la verificación en dos pasos no está activada")
+	}
+	if err := s.verifySecondFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, errors.New("no se pudieron generar los códigos de recuperación")
+	}
+	_, err = s.repo.Update(ctx, user.ID, bson.M{"$set": bson.M{
+		"recovery_code_hashes": hashes,
+		"updated_at":           time.Now(),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// MFATokenUserID devuelve el usuario de un token "mfa pending" con firma válida ("" si no lo es).
+// Sirve para contar los códigos fallidos por cuenta y no solo por token.
+func (s *authService) MFATokenUserID(mfaToken string) string {
+	claims, err := s.keys.parse(mfaToken)
+	if err != nil {
+		return ""
+	}
+	if typ, _ := claims["typ"].(string); typ != "mfa" {
+		return ""
+	}
+	userID, _ := claims["id"].(string)
+	return userID
+}
+
+// CompleteMFALogin canjea el token "mfa pending" y un código válido por una sesión.
+func (s *authService) CompleteMFALogin(ctx context.Context, req MFALoginRequest) (*AuthTokens, error) {
+	claims, err := s.keys.parse(req.MFAToken)
+	if err != nil {
+		return nil, errInvalidMFAToken
+	}
+	if typ, _ := claims["typ"].(string); typ != "mfa" {
+		return nil, errInvalidMFAToken
+	}
+	userIDStr, _ := claims["id"].(string)
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, errInvalidMFAToken
+	}
+
+	// El token solo vale mientras su jti siga pendiente en user_tokens
+	pending, err := s.userTokens.FindValid(ctx, models.TokenPurposeMFALogin, hashToken(jti))
+	if err != nil || pending.UserID.Hex() != userIDStr {
+		return nil, errInvalidMFAToken
+	}
+
+	user, err := s.findUser(ctx, userIDStr)
+	if err != nil || !user.TwoFactorEnabled {
+		return nil, errInvalidMFAToken
+	}
+	if err := checkAccountActive(user); err != nil {
+		return nil, err
+	}
+	if err := s.verifySecondFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		s.audit.Record(ctx, user.ID, models.AuditLoginFailed, map[string]interface{}{"reason": "second_factor"})
+		if ferr := s.userTokens.RecordFailure(ctx, pending.ID, maxMFAAttempts); ferr != nil {
+			return nil, ferr
+		}
+		return nil, err
+	}
+
+	// Un solo uso: si otra petición lo canjeó a la vez, esta no inicia sesión
+	res, err := s.userTokens.MarkUsed(ctx, pending.ID)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errInvalidMFAToken
+	}
+
+	tokens, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	method := "totp"
+	if req.Code == "" {
+		method = "recovery_code"
+	}
+	s.audit.Record(ctx, user.ID, models.AuditLoginSucceeded, map[string]interface{}{"method": method})
+	return tokens, nil
+}
@@ -3,25 +3,43 @@ package services
 import (
 	"context"
 	"errors"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/JimcostDev/finances-api/config"
 	"github.com/JimcostDev/finances-api/models"
 	"github.com/JimcostDev/finances-api/repositories"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// ReportChurchRecalculator recalcula reportes cuando el usuario cambia enable_church_contributions.
+// ReportChurchRecalculator recalcula reportes cuando el usuario cambia enable_church_contributions, church_settings,
+// deductions o enable_carry_over.
 type ReportChurchRecalculator interface {
-	RecalculateAllReportsForUser(ctx context.Context, userIDStr string, churchEnabled bool) error
+	RecalculateAllReportsForUser(ctx context.Context, userIDStr string) error
+}
+
+// CredentialVerifier comprueba credenciales sin iniciar sesión (lo implementa AuthService).
+type CredentialVerifier interface {
+	VerifyCredentials(ctx context.Context, email, password, code, recoveryCode string) (*models.User, error)
+}
+
+// EmailVerificationSender envía el enlace de verificación cuando el usuario cambia su email.
+type EmailVerificationSender interface {
+	RequestEmailVerification(ctx context.Context, user *models.User, email string) error
 }
 
 type UserService interface {
 	GetUserProfile(ctx context.Context, userIDStr string) (*models.User, error)
 	UpdateUser(ctx context.Context, userIDStr string, req UpdateUserRequest) error
-	DeleteUser(ctx context.Context, userIDStr string) error
+	// DeleteUser programa el borrado: la cuenta queda bloqueada y se puede restaurar durante el plazo de gracia.
+	DeleteUser(ctx context.Context, userIDStr string) (*time.Time, error)
+	RestoreUser(ctx context.Context, req RestoreAccountRequest) error
+	// PurgeDeletedUsers borra definitivamente las cuentas cuyo plazo terminó y devuelve cuántas.
+	PurgeDeletedUsers(ctx context.Context) (int, error)
+	GetAuditLog(ctx context.Context, userIDStr string, page, limit int) (*AuditLogPage, error)
 }
 
 type UpdateUserRequest struct {
@@ -31,24 +49,62 @@ type UpdateUserRequest struct {
 	Password                  string `json:"password,omitempty"`
 	ConfirmPassword           string `json:"confirm_password,omitempty"`
 	EnableChurchContributions *bool  `json:"enable_church_contributions,omitempty"`
+	// ChurchSettings sustituye la configuración de diezmo y aportes
+	ChurchSettings *models.ChurchSettings `json:"church_settings,omitempty"`
+	// Deductions sustituye todas las reglas de deducción ([] las elimina)
+	Deductions *[]models.DeductionRule `json:"deductions,omitempty"`
+	// EnableCarryOver activa el arrastre de la liquidación al mes siguiente
+	EnableCarryOver *bool `json:"enable_carry_over,omitempty"`
+}
+
+// RestoreAccountRequest: credenciales de la cuenta pendiente de eliminación (code/recovery_code si tiene 2FA).
+type RestoreAccountRequest struct {
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
 }
 
 type userService struct {
-	userRepo   repositories.UserRepository
-	reportRepo repositories.ReportRepository
-	client     *mongo.Client // Necesario para transacciones
-	recalc     ReportChurchRecalculator
+	userRepo    repositories.UserRepository
+	reportRepo  repositories.ReportRepository
+	sessions    repositories.SessionRepository
+	accountData AccountDataRepositories
+	client      *mongo.Client // Necesario para transacciones
+	recalc      ReportChurchRecalculator
+	verifier    EmailVerificationSender
+	credentials CredentialVerifier
+	audit       AuditService
+}
+
+// AccountDataRepositories agrupa el resto de colecciones con datos del usuario que se borran
+// junto con la cuenta.
+type AccountDataRepositories struct {
+	PersonalTokens repositories.PersonalTokenRepository
+	UserTokens     repositories.UserTokenRepository
+	Audit          repositories.AuditRepository
+	Exports        repositories.ExportRepository
 }
 
-func NewUserService(uRepo repositories.UserRepository, rRepo repositories.ReportRepository, client *mongo.Client, recalc ReportChurchRecalculator) UserService {
+func NewUserService(uRepo repositories.UserRepository, rRepo repositories.ReportRepository, sessions repositories.SessionRepository, accountData AccountDataRepositories, client *mongo.Client, recalc ReportChurchRecalculator, verifier EmailVerificationSender, credentials CredentialVerifier, audit AuditService) UserService {
 	return &userService{
-		userRepo:   uRepo,
-		reportRepo: rRepo,
-		client:     client,
-		recalc:     recalc,
+		userRepo:    uRepo,
+		reportRepo:  rRepo,
+		sessions:    sessions,
+		accountData: accountData,
+		client:      client,
+		recalc:      recalc,
+		verifier:    verifier,
+		credentials: credentials,
+		audit:       audit,
 	}
 }
 
+// accountDeletionGrace: plazo para restaurar una cuenta borrada (ACCOUNT_DELETION_GRACE_DAYS, 30 por defecto).
+func accountDeletionGrace() time.Duration {
+	return time.Duration(config.EnvInt("ACCOUNT_DELETION_GRACE_DAYS", 30)) * 24 * time.Hour
+}
+
 func (s *userService) GetUserProfile(ctx context.Context, userIDStr string) (*models.User, error) {
 	oid, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
@@ -63,6 +119,11 @@ func (s *userService) GetUserProfile(ctx context.Context, userIDStr string) (*mo
 	return user, nil
 }
 
+// GetAuditLog devuelve una página de la actividad de seguridad de la cuenta.
+func (s *userService) GetAuditLog(ctx context.Context, userIDStr string, page, limit int) (*AuditLogPage, error) {
+	return s.audit.ListForUser(ctx, userIDStr, page, limit)
+}
+
 func (s *userService) UpdateUser(ctx context.Context, userIDStr string, req UpdateUserRequest) error {
 	oid, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
@@ -73,25 +134,31 @@ func (s *userService) UpdateUser(ctx context.Context, userIDStr string, req Upda
 		return errors.New("las contraseñas no coinciden")
 	}
 
+	current, err := s.userRepo.FindByID(ctx, oid)
+	if err != nil {
+		return errors.New("usuario no encontrado")
+	}
 	var previousChurch *bool
 	if req.EnableChurchContributions != nil {
-		existing, err := s.userRepo.FindByID(ctx, oid)
-		if err != nil {
-			return errors.New("usuario no encontrado")
-		}
-		v := existing.EnableChurchContributions
+		v := current.EnableChurchContributions
 		previousChurch = &v
 	}
 
 	updateData := bson.M{"updated_at": time.Now()}
 
-	// Validar Email único
-	if req.Email != "" {
+	// Validar Email único. El nuevo email queda pendiente hasta que se verifique.
+	newEmail := ""
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email != "" && req.Email != current.Email {
+		if err := validateEmail(req.Email); err != nil {
+			return err
+		}
 		existing, err := s.userRepo.FindByEmail(ctx, req.Email)
 		if err == nil && existing.ID != oid {
 			return errors.New("el email ya está en uso")
 		}
-		updateData["email"] = req.Email
+		updateData["pending_email"] = req.Email
+		newEmail = req.Email
 	}
 
 	// Validar Username único
@@ -108,35 +175,157 @@ func (s *userService) UpdateUser(ctx context.Context, userIDStr string, req Upda
 	}
 
 	if req.Password != "" {
-		hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		email, username := current.Email, current.Username
+		if newEmail != "" {
+			email = newEmail
+		}
+		if req.Username != "" {
+			username = req.Username
+		}
+		if err := validatePassword(req.Password, email, username); err != nil {
+			return err
+		}
+		hashed, err := hashPassword(req.Password)
 		if err != nil {
-			return errors.New("error al encriptar contraseña")
+			return err
 		}
-		updateData["password"] = string(hashed)
+		updateData["password"] = hashed
 	}
 
 	if req.EnableChurchContributions != nil {
 		updateData["enable_church_contributions"] = *req.EnableChurchContributions
 	}
 
+	if req.EnableCarryOver != nil {
+		updateData["enable_carry_over"] = *req.EnableCarryOver
+	}
+
+	if req.ChurchSettings != nil {
+		if err := req.ChurchSettings.Normalize(); err != nil {
+			return err
+		}
+		updateData["church_settings"] = req.ChurchSettings
+	}
+
+	if req.Deductions != nil {
+		if err := models.NormalizeDeductionRules(*req.Deductions); err != nil {
+			return err
+		}
+		updateData["deductions"] = *req.Deductions
+	}
+
 	_, err = s.userRepo.Update(ctx, oid, bson.M{"$set": updateData})
 	if err != nil {
 		return err
 	}
 
-	if req.EnableChurchContributions != nil && previousChurch != nil &&
-		*req.EnableChurchContributions != *previousChurch && s.recalc != nil {
-		if err := s.recalc.RecalculateAllReportsForUser(ctx, userIDStr, *req.EnableChurchContributions); err != nil {
+	if req.Password != "" {
+		s.audit.Record(ctx, oid, models.AuditPasswordChanged, nil)
+	}
+	if newEmail != "" {
+		s.audit.Record(ctx, oid, models.AuditEmailChangeRequested, map[string]interface{}{"to": newEmail})
+	}
+	if req.EnableChurchContributions != nil && *req.EnableChurchContributions != *previousChurch {
+		s.audit.Record(ctx, oid, models.AuditChurchContributionsChanged, map[string]interface{}{"enabled": *req.EnableChurchContributions})
+	}
+	if req.ChurchSettings != nil {
+		s.audit.Record(ctx, oid, models.AuditChurchContributionsChanged, map[string]interface{}{"settings": req.ChurchSettings})
+	}
+	if req.Deductions != nil {
+		s.audit.Record(ctx, oid, models.AuditDeductionsChanged, map[string]interface{}{"rules": *req.Deductions})
+	}
+
+	if newEmail != "" && s.verifier != nil {
+		if err := s.verifier.RequestEmailVerification(ctx, current, newEmail); err != nil {
+			log.Printf("no se pudo enviar el correo de verificación a %s: %v", newEmail, err)
+		}
+	}
+
+	churchToggled := req.EnableChurchContributions != nil && previousChurch != nil && *req.EnableChurchContributions != *previousChurch
+	carryOverToggled := req.EnableCarryOver != nil && *req.EnableCarryOver != current.EnableCarryOver
+	if (churchToggled || carryOverToggled || req.ChurchSettings != nil || req.Deductions != nil) && s.recalc != nil {
+		if err := s.recalc.RecalculateAllReportsForUser(ctx, userIDStr); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *userService) DeleteUser(ctx context.Context, userIDStr string) error {
+func (s *userService) DeleteUser(ctx context.Context, userIDStr string) (*time.Time, error) {
 	oid, err := primitive.ObjectIDFromHex(userIDStr)
 	if err != nil {
-		return errors.New("ID inválido")
+		return nil, errors.New("ID inválido")
+	}
+
+	now := time.Now()
+	scheduledAt := now.Add(accountDeletionGrace())
+	res, err := s.userRepo.Update(ctx, oid, bson.M{"$set": bson.M{
+		"deletion_requested_at": now,
+		"deletion_scheduled_at": scheduledAt,
+		"updated_at":            now,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("usuario no encontrado")
+	}
+
+	// Se cierran todas las sesiones; el login queda bloqueado hasta restaurar la cuenta
+	if _, err := s.sessions.RevokeAllByUser(ctx, oid, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, oid, models.AuditAccountDeletionRequested, map[string]interface{}{"scheduled_at": scheduledAt})
+	return &scheduledAt, nil
+}
+
+// RestoreUser cancela el borrado programado. Como el login está bloqueado, se identifica con credenciales.
+func (s *userService) RestoreUser(ctx context.Context, req RestoreAccountRequest) error {
+	user, err := s.credentials.VerifyCredentials(ctx, req.Email, req.Password, req.Code, req.RecoveryCode)
+	if err != nil {
+		return err
+	}
+	if user.DeletionScheduledAt == nil {
+		return errors.New("la cuenta no está pendiente de eliminación")
+	}
+	if !time.Now().Before(*user.DeletionScheduledAt) {
+		return errors.New("el plazo para restaurar la cuenta ha terminado")
+	}
+
+	_, err = s.userRepo.Update(ctx, user.ID, bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"deletion_requested_at": "", "deletion_scheduled_at": ""},
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user.ID, models.AuditAccountRestored, nil)
+	return nil
+}
+
+func (s *userService) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	users, err := s.userRepo.FindDeletionDue(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, user := range users {
+		if err := s.hardDeleteUser(ctx, user.ID); err != nil {
+			return purged, err
+		}
+		// De la cuenta solo queda el evento de su borrado definitivo
+		s.audit.Record(ctx, user.ID, models.AuditAccountDeleted, nil)
+		purged++
+	}
+	return purged, nil
+}
+
+// hardDeleteUser elimina el usuario y todos sus datos: reportes, sesiones, tokens personales y de un
+// solo uso, exportaciones y auditoría en una transacción. Los archivos de GridFS no admiten
+// transacción y se borran antes: si falla, el usuario sigue pendiente y el purgador lo reintenta.
+func (s *userService) hardDeleteUser(ctx context.Context, oid primitive.ObjectID) error {
+	if err := s.accountData.Exports.DeleteFilesByUserID(ctx, oid); err != nil {
+		return err
 	}
 
 	// Iniciar Sesión para Transacción
@@ -147,7 +336,7 @@ func (s *userService) DeleteUser(ctx context.Context, userIDStr string) error {
 	defer session.EndSession(ctx)
 
 	// Ejecutar transacción
-	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
+	return mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
 		if err := session.StartTransaction(); err != nil {
 			return err
 		}
@@ -164,8 +353,21 @@ func (s *userService) DeleteUser(ctx context.Context, userIDStr string) error {
 			return err
 		}
 
+		// 3. Eliminar sesiones, tokens, exportaciones y auditoría
+		deletes := []func(context.Context, primitive.ObjectID) (*mongo.DeleteResult, error){
+			s.sessions.DeleteAllByUserID,
+			s.accountData.PersonalTokens.DeleteAllByUserID,
+			s.accountData.UserTokens.DeleteAllByUserID,
+			s.accountData.Exports.DeleteAllByUserID,
+			s.accountData.Audit.DeleteAllByUserID,
+		}
+		for _, deleteAll := range deletes {
+			if _, err := deleteAll(sessionContext, oid); err != nil {
+				session.AbortTransaction(sessionContext)
+				return err
+			}
+		}
+
 		return session.CommitTransaction(sessionContext)
 	})
-
-	return err
 }